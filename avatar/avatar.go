@@ -0,0 +1,131 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // register the gif decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the webp decoder
+)
+
+const (
+	// MaxUploadSize is the largest image file accepted
+	MaxUploadSize = 5 << 20
+	// maxPixels guards against small files that decode to huge images
+	maxPixels = 40 << 20
+	// jpegQuality is the quality variants are encoded at
+	jpegQuality = 85
+)
+
+// Sizes lists the width of every variant made of an avatar, smallest
+// first. Variants are square so this is also their height
+var Sizes = []int{64, 128, 256, 512}
+
+var (
+	// ErrTooLarge is returned for files over MaxUploadSize or images with
+	// too many pixels
+	ErrTooLarge = errors.New("avatar: image is too large")
+	// ErrUnsupported is returned for files that are not JPEG, PNG, GIF or
+	// WebP images
+	ErrUnsupported = errors.New("avatar: image type is not supported")
+)
+
+// Avatar is an uploaded image cropped square and resized to every size in
+// Sizes. Re-encoding drops any metadata the upload had, EXIF included
+type Avatar struct {
+	ContentType string
+	Ext         string
+	Variants    map[int][]byte
+}
+
+// Process reads an uploaded image, checks what it really is from its
+// content rather than what the client claimed, and makes the variants
+func Process(r io.Reader) (*Avatar, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxUploadSize {
+		return nil, ErrTooLarge
+	}
+	sniffed := http.DetectContentType(data)
+	switch sniffed {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return nil, ErrUnsupported
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if sniffed == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	avatar := &Avatar{
+		ContentType: "image/png",
+		Ext:         ".png",
+		Variants:    make(map[int][]byte, len(Sizes)),
+	}
+	if opaque(img) {
+		avatar.ContentType = "image/jpeg"
+		avatar.Ext = ".jpg"
+	}
+	square := cropSquare(img)
+	for _, size := range Sizes {
+		dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), square, square.Bounds(), draw.Src, nil)
+		var buf bytes.Buffer
+		if avatar.ContentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		avatar.Variants[size] = buf.Bytes()
+	}
+	return avatar, nil
+}
+
+// cropSquare cuts the largest centred square out of img
+func cropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, image.Pt(x, y), draw.Src)
+	return dst
+}
+
+// opaque reports whether img has no transparent pixels, so it can be
+// stored as a JPEG
+func opaque(img image.Image) bool {
+	switch m := img.(type) {
+	case *image.YCbCr, *image.Gray, *image.CMYK:
+		return true
+	case interface{ Opaque() bool }:
+		return m.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,548 @@
+// Package config loads the application settings from a JSON or YAML
+// file, PROFILE_* environment variables and command line flags. Later
+// sources win, so flags override the environment which overrides the file
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"profile.com/hash"
+	"profile.com/storage"
+)
+
+const (
+	// EnvDevelopment is the default environment
+	EnvDevelopment = "development"
+	// EnvProduction refuses to start with the default secrets
+	EnvProduction = "production"
+
+	// DefaultPepper is only good for development
+	DefaultPepper = "secret-user-pepper"
+	// DefaultHMACKey is only good for development
+	DefaultHMACKey = "secret-key"
+
+	// StorageDisk keeps uploads under UploadsDir
+	StorageDisk = "disk"
+	// StorageS3 keeps uploads in an S3 compatible bucket
+	StorageS3 = "s3"
+
+	// minSecretLength is the shortest secret accepted in production
+	minSecretLength = 32
+)
+
+var (
+	// ErrFileType is returned when the config file is not JSON or YAML
+	ErrFileType = errors.New("config: Config file must end in .json, .yaml or .yml")
+	// ErrEnvInvalid is returned for an unknown environment
+	ErrEnvInvalid = errors.New("config: env must be development or production")
+	// ErrAddrMissing is returned when there is no address to listen on
+	ErrAddrMissing = errors.New("config: addr is missing")
+	// ErrBaseURLInvalid is returned when the base URL is not an absolute http(s) URL
+	ErrBaseURLInvalid = errors.New("config: base_url must be an absolute http or https URL without a query")
+	// ErrBaseURLInsecure is returned in production when links would use plain HTTP
+	ErrBaseURLInsecure = errors.New("config: base_url must use https in production")
+	// ErrDatabaseInvalid is returned when the database settings are incomplete
+	ErrDatabaseInvalid = errors.New("config: database needs a host, port between 1 and 65535, user and name")
+	// ErrSecretMissing is returned when the pepper or HMAC key is empty
+	ErrSecretMissing = errors.New("config: pepper and hmac_key are required")
+	// ErrDefaultSecret is returned in production when a secret was left at its default
+	ErrDefaultSecret = errors.New("config: pepper and hmac_key must be changed from their defaults in production")
+	// ErrSecretTooShort is returned in production when a secret is too easy to guess
+	ErrSecretTooShort = errors.New("config: pepper and hmac_key must be at least 32 characters in production")
+	// ErrPepperIDReused is returned when the current pepper ID is also an old pepper
+	ErrPepperIDReused = errors.New("config: password.pepper_id must differ from the old_peppers IDs")
+	// ErrRateLimitStoreInvalid is returned for an unknown rate limit store
+	ErrRateLimitStoreInvalid = errors.New("config: rate_limit_store must be memory or postgres")
+	// ErrStorageInvalid is returned for an unknown storage backend
+	ErrStorageInvalid = errors.New("config: storage must be disk or s3")
+	// ErrS3Invalid is returned when the S3 storage settings are incomplete
+	ErrS3Invalid = errors.New("config: s3 storage needs an endpoint, bucket, access_key and secret_key")
+	// ErrInsecureCookie is returned in production when cookies may be sent over plain HTTP
+	ErrInsecureCookie = errors.New("config: cookie.secure must be true in production")
+)
+
+// Config defines the shape of the application settings
+type Config struct {
+	Env  string `json:"env" yaml:"env"`
+	Addr string `json:"addr" yaml:"addr"`
+	// BaseURL is the public address of the site, emailed and shared links
+	// are built on it
+	BaseURL    string `json:"base_url" yaml:"base_url"`
+	UploadsDir string `json:"uploads_dir" yaml:"uploads_dir"`
+	Pepper     string `json:"pepper" yaml:"pepper"`
+	HMACKey    string `json:"hmac_key" yaml:"hmac_key"`
+	// HMACKeyring is the keyring file that replaces HMACKey once the key
+	// has been rotated
+	HMACKeyring string         `json:"hmac_keyring" yaml:"hmac_keyring"`
+	Database    DatabaseConfig `json:"database" yaml:"database"`
+	Cookie      CookieConfig   `json:"cookie" yaml:"cookie"`
+	Password    PasswordConfig `json:"password" yaml:"password"`
+	// RateLimitStore keeps the rate limits and login throttles, memory, or
+	// postgres to share them across instances
+	RateLimitStore string `json:"rate_limit_store" yaml:"rate_limit_store"`
+	// Storage is where uploads are kept, disk or s3
+	Storage string   `json:"storage" yaml:"storage"`
+	S3      S3Config `json:"s3" yaml:"s3"`
+}
+
+// DatabaseConfig defines the postgres connection settings
+type DatabaseConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password" yaml:"password"`
+	Name     string `json:"name" yaml:"name"`
+	SSLMode  string `json:"sslmode" yaml:"sslmode"`
+}
+
+// PasswordConfig defines how passwords are hashed. New hashes use the
+// top level pepper under PepperID, OldPeppers keeps the retired peppers by
+// ID so older hashes still verify until their owners next sign in
+type PasswordConfig struct {
+	Algorithm         string            `json:"algorithm" yaml:"algorithm"`
+	BcryptCost        int               `json:"bcrypt_cost" yaml:"bcrypt_cost"`
+	Argon2Memory      uint32            `json:"argon2_memory" yaml:"argon2_memory"`
+	Argon2Iterations  uint32            `json:"argon2_iterations" yaml:"argon2_iterations"`
+	Argon2Parallelism uint8             `json:"argon2_parallelism" yaml:"argon2_parallelism"`
+	PepperID          string            `json:"pepper_id" yaml:"pepper_id"`
+	OldPeppers        map[string]string `json:"old_peppers" yaml:"old_peppers"`
+}
+
+// S3Config defines the bucket uploads are kept in when Storage is s3
+type S3Config struct {
+	// Endpoint is the host and port of the service, without a scheme
+	Endpoint  string `json:"endpoint" yaml:"endpoint"`
+	AccessKey string `json:"access_key" yaml:"access_key"`
+	SecretKey string `json:"secret_key" yaml:"secret_key"`
+	Bucket    string `json:"bucket" yaml:"bucket"`
+	Region    string `json:"region" yaml:"region"`
+	UseSSL    bool   `json:"use_ssl" yaml:"use_ssl"`
+}
+
+// CookieConfig defines the attributes given to the cookies we set
+type CookieConfig struct {
+	Secure bool   `json:"secure" yaml:"secure"`
+	Domain string `json:"domain" yaml:"domain"`
+}
+
+// Default returns the development settings
+func Default() Config {
+	return Config{
+		Env:            EnvDevelopment,
+		Addr:           ":8080",
+		BaseURL:        "http://localhost:8080",
+		UploadsDir:     "uploads",
+		Pepper:         DefaultPepper,
+		HMACKey:        DefaultHMACKey,
+		RateLimitStore: "postgres",
+		Storage:        StorageDisk,
+		S3: S3Config{
+			UseSSL: true,
+		},
+		Password: PasswordConfig{
+			Algorithm:         hash.Argon2id,
+			BcryptCost:        12,
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 4,
+			PepperID:          hash.LegacyPepperID,
+		},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "profile_dev",
+			SSLMode: "disable",
+		},
+	}
+}
+
+// IsProduction reports whether the app runs in production
+func (c Config) IsProduction() bool {
+	return c.Env == EnvProduction
+}
+
+// ConnectionInfo returns the postgres connection string
+func (c DatabaseConfig) ConnectionInfo() string {
+	info := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Name, c.SSLMode)
+	if c.Password != "" {
+		info += " password=" + quoteConnValue(c.Password)
+	}
+	return info
+}
+
+// quoteConnValue quotes v for a libpq key=value connection string
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+// Keyring loads the HMAC keyring file, or returns a keyring holding only
+// HMACKey until the first rotation has written one
+func (c Config) Keyring() (*hash.Keyring, error) {
+	if c.HMACKeyring == "" {
+		return hash.NewKeyring(c.HMACKey), nil
+	}
+	kr, err := hash.LoadKeyring(c.HMACKeyring)
+	if os.IsNotExist(err) {
+		return hash.NewKeyring(c.HMACKey), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", c.HMACKeyring, err)
+	}
+	return kr, nil
+}
+
+// S3Options returns the settings of the S3 store
+func (c Config) S3Options() storage.S3Options {
+	return storage.S3Options{
+		Endpoint:  c.S3.Endpoint,
+		AccessKey: c.S3.AccessKey,
+		SecretKey: c.S3.SecretKey,
+		Bucket:    c.S3.Bucket,
+		Region:    c.S3.Region,
+		UseSSL:    c.S3.UseSSL,
+	}
+}
+
+// PasswordOptions returns the password hasher options, with the current
+// pepper added to the old ones
+func (c Config) PasswordOptions() hash.PasswordOptions {
+	peppers := map[string]string{}
+	for id, pepper := range c.Password.OldPeppers {
+		peppers[id] = pepper
+	}
+	peppers[c.Password.PepperID] = c.Pepper
+	return hash.PasswordOptions{
+		Algorithm:  c.Password.Algorithm,
+		BcryptCost: c.Password.BcryptCost,
+		Argon2: hash.Argon2Params{
+			Memory:      c.Password.Argon2Memory,
+			Iterations:  c.Password.Argon2Iterations,
+			Parallelism: c.Password.Argon2Parallelism,
+		},
+		PepperID: c.Password.PepperID,
+		Peppers:  peppers,
+	}
+}
+
+// Validate checks the settings are complete, and in production that no
+// default or weak secrets are used
+func (c Config) Validate() error {
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		return ErrEnvInvalid
+	}
+	if c.Addr == "" {
+		return ErrAddrMissing
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" ||
+		base.RawQuery != "" || base.Fragment != "" || base.User != nil {
+		return ErrBaseURLInvalid
+	}
+	db := c.Database
+	if db.Host == "" || db.User == "" || db.Name == "" || db.Port < 1 || db.Port > 65535 {
+		return ErrDatabaseInvalid
+	}
+	if c.Pepper == "" || c.HMACKey == "" {
+		return ErrSecretMissing
+	}
+	if _, ok := c.Password.OldPeppers[c.Password.PepperID]; ok {
+		return ErrPepperIDReused
+	}
+	if _, err := hash.NewPasswordHasher(c.PasswordOptions()); err != nil {
+		return fmt.Errorf("config: password: %w", err)
+	}
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "postgres" {
+		return ErrRateLimitStoreInvalid
+	}
+	switch c.Storage {
+	case StorageDisk:
+	case StorageS3:
+		s3 := c.S3
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			return ErrS3Invalid
+		}
+	default:
+		return ErrStorageInvalid
+	}
+	if !c.IsProduction() {
+		return nil
+	}
+	if c.Pepper == DefaultPepper || c.HMACKey == DefaultHMACKey {
+		return ErrDefaultSecret
+	}
+	if len(c.Pepper) < minSecretLength || len(c.HMACKey) < minSecretLength {
+		return ErrSecretTooShort
+	}
+	if !c.Cookie.Secure {
+		return ErrInsecureCookie
+	}
+	if base.Scheme != "https" {
+		return ErrBaseURLInsecure
+	}
+	return nil
+}
+
+// Load builds the config from the defaults, the file named by -config or
+// PROFILE_CONFIG, the environment and the flags in args, then validates
+// it. The arguments left after the flags are returned
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("PROFILE_CONFIG"), "path to a JSON or YAML config file")
+	flags := map[string]*settingFlag{}
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		f := &settingFlag{isBool: s.isBool}
+		flags[s.flag] = f
+		fs.Var(f, s.flag, s.usage+" ("+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := loadFile(&cfg, *configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(&cfg, v); err != nil {
+				return nil, nil, fmt.Errorf("config: %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if f, ok := flags[s.flag]; ok && f.set {
+			if err := s.set(&cfg, f.value); err != nil {
+				return nil, nil, fmt.Errorf("config: -%s: %w", s.flag, err)
+			}
+		}
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// loadFile decodes the file at path over cfg, rejecting unknown keys so
+// typos do not go unnoticed
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	default:
+		return ErrFileType
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// setting is one value that can come from the environment and, unless it
+// is a secret that should not show up in the process list, a flag
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"env", "PROFILE_ENV", "development or production", false, func(c *Config, v string) error {
+		c.Env = v
+		return nil
+	}},
+	{"addr", "PROFILE_ADDR", "address to listen on", false, func(c *Config, v string) error {
+		c.Addr = v
+		return nil
+	}},
+	{"base-url", "PROFILE_BASE_URL", "public URL emailed links point to", false, func(c *Config, v string) error {
+		c.BaseURL = v
+		return nil
+	}},
+	{"uploads-dir", "PROFILE_UPLOADS_DIR", "directory uploaded files are stored in", false, func(c *Config, v string) error {
+		c.UploadsDir = v
+		return nil
+	}},
+	{"hmac-keyring", "PROFILE_HMAC_KEYRING", "HMAC keyring file written by the keys command", false, func(c *Config, v string) error {
+		c.HMACKeyring = v
+		return nil
+	}},
+	{"", "PROFILE_PEPPER", "", false, func(c *Config, v string) error {
+		c.Pepper = v
+		return nil
+	}},
+	{"", "PROFILE_HMAC_KEY", "", false, func(c *Config, v string) error {
+		c.HMACKey = v
+		return nil
+	}},
+	{"db-host", "PROFILE_DB_HOST", "database host", false, func(c *Config, v string) error {
+		c.Database.Host = v
+		return nil
+	}},
+	{"db-port", "PROFILE_DB_PORT", "database port", false, func(c *Config, v string) error {
+		port, err := strconv.Atoi(v)
+		c.Database.Port = port
+		return err
+	}},
+	{"db-user", "PROFILE_DB_USER", "database user", false, func(c *Config, v string) error {
+		c.Database.User = v
+		return nil
+	}},
+	{"", "PROFILE_DB_PASSWORD", "", false, func(c *Config, v string) error {
+		c.Database.Password = v
+		return nil
+	}},
+	{"db-name", "PROFILE_DB_NAME", "database name", false, func(c *Config, v string) error {
+		c.Database.Name = v
+		return nil
+	}},
+	{"db-sslmode", "PROFILE_DB_SSLMODE", "database sslmode", false, func(c *Config, v string) error {
+		c.Database.SSLMode = v
+		return nil
+	}},
+	{"password-algorithm", "PROFILE_PASSWORD_ALGORITHM", "argon2id or bcrypt", false, func(c *Config, v string) error {
+		c.Password.Algorithm = v
+		return nil
+	}},
+	{"bcrypt-cost", "PROFILE_BCRYPT_COST", "bcrypt cost", false, func(c *Config, v string) error {
+		cost, err := strconv.Atoi(v)
+		c.Password.BcryptCost = cost
+		return err
+	}},
+	{"argon2-memory", "PROFILE_ARGON2_MEMORY", "argon2id memory in KiB", false, func(c *Config, v string) error {
+		memory, err := strconv.ParseUint(v, 10, 32)
+		c.Password.Argon2Memory = uint32(memory)
+		return err
+	}},
+	{"argon2-iterations", "PROFILE_ARGON2_ITERATIONS", "argon2id iterations", false, func(c *Config, v string) error {
+		iterations, err := strconv.ParseUint(v, 10, 32)
+		c.Password.Argon2Iterations = uint32(iterations)
+		return err
+	}},
+	{"argon2-parallelism", "PROFILE_ARGON2_PARALLELISM", "argon2id threads", false, func(c *Config, v string) error {
+		parallelism, err := strconv.ParseUint(v, 10, 8)
+		c.Password.Argon2Parallelism = uint8(parallelism)
+		return err
+	}},
+	{"pepper-id", "PROFILE_PEPPER_ID", "ID of the current pepper", false, func(c *Config, v string) error {
+		c.Password.PepperID = v
+		return nil
+	}},
+	{"", "PROFILE_OLD_PEPPERS", "", false, func(c *Config, v string) error {
+		peppers, err := parsePeppers(v)
+		c.Password.OldPeppers = peppers
+		return err
+	}},
+	{"rate-limit-store", "PROFILE_RATE_LIMIT_STORE", "memory or postgres", false, func(c *Config, v string) error {
+		c.RateLimitStore = v
+		return nil
+	}},
+	{"storage", "PROFILE_STORAGE", "where uploads are kept, disk or s3", false, func(c *Config, v string) error {
+		c.Storage = v
+		return nil
+	}},
+	{"s3-endpoint", "PROFILE_S3_ENDPOINT", "S3 host and port", false, func(c *Config, v string) error {
+		c.S3.Endpoint = v
+		return nil
+	}},
+	{"s3-access-key", "PROFILE_S3_ACCESS_KEY", "S3 access key", false, func(c *Config, v string) error {
+		c.S3.AccessKey = v
+		return nil
+	}},
+	{"", "PROFILE_S3_SECRET_KEY", "", false, func(c *Config, v string) error {
+		c.S3.SecretKey = v
+		return nil
+	}},
+	{"s3-bucket", "PROFILE_S3_BUCKET", "S3 bucket uploads are kept in", false, func(c *Config, v string) error {
+		c.S3.Bucket = v
+		return nil
+	}},
+	{"s3-region", "PROFILE_S3_REGION", "S3 region", false, func(c *Config, v string) error {
+		c.S3.Region = v
+		return nil
+	}},
+	{"s3-use-ssl", "PROFILE_S3_USE_SSL", "connect to S3 over HTTPS", true, func(c *Config, v string) error {
+		useSSL, err := strconv.ParseBool(v)
+		c.S3.UseSSL = useSSL
+		return err
+	}},
+	{"cookie-secure", "PROFILE_COOKIE_SECURE", "only send cookies over HTTPS", true, func(c *Config, v string) error {
+		secure, err := strconv.ParseBool(v)
+		c.Cookie.Secure = secure
+		return err
+	}},
+	{"cookie-domain", "PROFILE_COOKIE_DOMAIN", "domain cookies are set for", false, func(c *Config, v string) error {
+		c.Cookie.Domain = v
+		return nil
+	}},
+}
+
+// parsePeppers reads retired peppers written as id=pepper,id=pepper
+func parsePeppers(v string) (map[string]string, error) {
+	peppers := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.New("peppers must be written as id=pepper,id=pepper")
+		}
+		peppers[strings.TrimSpace(kv[0])] = kv[1]
+	}
+	return peppers, nil
+}
+
+// settingFlag remembers the raw value of a flag and whether it was given,
+// so flags are only applied on top of the file and environment when set
+type settingFlag struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	return f.value
+}
+
+func (f *settingFlag) Set(v string) error {
+	f.value = v
+	f.set = true
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
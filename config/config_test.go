@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every PROFILE_* variable Load reads for the rest of the
+// test, so the environment the tests run in cannot leak into them
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range append([]string{"PROFILE_CONFIG"}, settingEnvs()...) {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+}
+
+func settingEnvs() []string {
+	var envs []string
+	for _, s := range settings {
+		envs = append(envs, s.env)
+	}
+	return envs
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testYAML = `
+addr: ":1000"
+uploads_dir: file-uploads
+database:
+  name: file_db
+  user: file_user
+cookie:
+  secure: true
+`
+
+const testJSON = `{
+	"addr": ":1000",
+	"uploads_dir": "file-uploads",
+	"database": {"name": "file_db", "user": "file_user"},
+	"cookie": {"secure": true}
+}`
+
+func TestLoadPrecedence(t *testing.T) {
+	type want struct {
+		addr, uploadsDir, dbName, dbUser, sslMode string
+		secure                                    bool
+	}
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		want     want
+		wantArgs []string
+	}{
+		{
+			name: "defaults",
+			want: want{":8080", "uploads", "profile_dev", "postgres", "disable", false},
+		},
+		{
+			name: "yaml file over defaults",
+			file: writeFile(t, "profile.yaml", testYAML),
+			want: want{":1000", "file-uploads", "file_db", "file_user", "disable", true},
+		},
+		{
+			name: "json file over defaults",
+			file: writeFile(t, "profile.json", testJSON),
+			want: want{":1000", "file-uploads", "file_db", "file_user", "disable", true},
+		},
+		{
+			name: "environment over file",
+			file: writeFile(t, "profile.yaml", testYAML),
+			env:  map[string]string{"PROFILE_ADDR": ":2000", "PROFILE_DB_NAME": "env_db", "PROFILE_COOKIE_SECURE": "false"},
+			want: want{":2000", "file-uploads", "env_db", "file_user", "disable", false},
+		},
+		{
+			name:     "flags over environment and file",
+			file:     writeFile(t, "profile.yaml", testYAML),
+			env:      map[string]string{"PROFILE_ADDR": ":2000", "PROFILE_DB_NAME": "env_db", "PROFILE_COOKIE_SECURE": "false"},
+			args:     []string{"-addr", ":3000", "-cookie-secure", "-db-sslmode", "require", "migrate", "up"},
+			want:     want{":3000", "file-uploads", "env_db", "file_user", "require", true},
+			wantArgs: []string{"migrate", "up"},
+		},
+		{
+			name: "flags over defaults",
+			args: []string{"-uploads-dir", "flag-uploads"},
+			want: want{":8080", "flag-uploads", "profile_dev", "postgres", "disable", false},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", tc.file}, args...)
+			}
+			cfg, rest, err := Load(args)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			got := want{cfg.Addr, cfg.UploadsDir, cfg.Database.Name, cfg.Database.User, cfg.Database.SSLMode, cfg.Cookie.Secure}
+			if got != tc.want {
+				t.Errorf("Load() = %+v, want %+v", got, tc.want)
+			}
+			if len(rest)+len(tc.wantArgs) > 0 && !reflect.DeepEqual(rest, tc.wantArgs) {
+				t.Errorf("args left = %q, want %q", rest, tc.wantArgs)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PROFILE_CONFIG", writeFile(t, "profile.yml", testYAML))
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Addr != ":1000" {
+		t.Errorf("Addr = %q, want the file's :1000", cfg.Addr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr error
+		wantMsg string
+	}{
+		{name: "unknown file type", file: writeFile(t, "profile.toml", `addr = ":1000"`), wantErr: ErrFileType},
+		{name: "unknown yaml key", file: writeFile(t, "profile.yaml", "adress: \":1000\"\n"), wantMsg: "adress"},
+		{name: "unknown json key", file: writeFile(t, "profile.json", `{"adress": ":1000"}`), wantMsg: "adress"},
+		{name: "bad number in environment", env: map[string]string{"PROFILE_DB_PORT": "fivefourthreetwo"}, wantMsg: "PROFILE_DB_PORT"},
+		{name: "bad bool flag", args: []string{"-cookie-secure=maybe"}, wantMsg: "-cookie-secure"},
+		{name: "invalid after loading", env: map[string]string{"PROFILE_STORAGE": "floppy"}, wantErr: ErrStorageInvalid},
+		{name: "production defaults", env: map[string]string{"PROFILE_ENV": "production"}, wantErr: ErrDefaultSecret},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", tc.file}, args...)
+			}
+			_, _, err := Load(args)
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantMsg != "" && !strings.Contains(err.Error(), tc.wantMsg) {
+				t.Errorf("Load() error = %v, want it to mention %q", err, tc.wantMsg)
+			}
+		})
+	}
+}
+
+// production returns settings that pass every production check
+func production() Config {
+	c := Default()
+	c.Env = EnvProduction
+	c.BaseURL = "https://profile.example.com"
+	c.Pepper = strings.Repeat("p", minSecretLength)
+	c.HMACKey = strings.Repeat("k", minSecretLength)
+	c.Cookie.Secure = true
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		dev     bool
+		wantErr error
+	}{
+		{name: "production", change: func(c *Config) {}},
+		{name: "development defaults", dev: true, change: func(c *Config) {}},
+		{name: "default pepper", change: func(c *Config) { c.Pepper = DefaultPepper }, wantErr: ErrDefaultSecret},
+		{name: "default hmac key", change: func(c *Config) { c.HMACKey = DefaultHMACKey }, wantErr: ErrDefaultSecret},
+		{name: "short pepper", change: func(c *Config) { c.Pepper = strings.Repeat("p", minSecretLength-1) }, wantErr: ErrSecretTooShort},
+		{name: "short hmac key", change: func(c *Config) { c.HMACKey = "short" }, wantErr: ErrSecretTooShort},
+		{name: "insecure cookies", change: func(c *Config) { c.Cookie.Secure = false }, wantErr: ErrInsecureCookie},
+		{name: "http base url", change: func(c *Config) { c.BaseURL = "http://profile.example.com" }, wantErr: ErrBaseURLInsecure},
+		{name: "missing secret", dev: true, change: func(c *Config) { c.HMACKey = "" }, wantErr: ErrSecretMissing},
+		{name: "unknown env", change: func(c *Config) { c.Env = "staging" }, wantErr: ErrEnvInvalid},
+		{name: "missing addr", change: func(c *Config) { c.Addr = "" }, wantErr: ErrAddrMissing},
+		{name: "relative base url", change: func(c *Config) { c.BaseURL = "/profile" }, wantErr: ErrBaseURLInvalid},
+		{name: "base url with a query", change: func(c *Config) { c.BaseURL = "https://profile.example.com/?a=b" }, wantErr: ErrBaseURLInvalid},
+		{name: "base url with credentials", change: func(c *Config) { c.BaseURL = "https://u:p@profile.example.com" }, wantErr: ErrBaseURLInvalid},
+		{name: "database port", change: func(c *Config) { c.Database.Port = 70000 }, wantErr: ErrDatabaseInvalid},
+		{name: "pepper id reused", change: func(c *Config) {
+			c.Password.OldPeppers = map[string]string{c.Password.PepperID: "old"}
+		}, wantErr: ErrPepperIDReused},
+		{name: "rate limit store", change: func(c *Config) { c.RateLimitStore = "redis" }, wantErr: ErrRateLimitStoreInvalid},
+		{name: "storage", change: func(c *Config) { c.Storage = "floppy" }, wantErr: ErrStorageInvalid},
+		{name: "incomplete s3", change: func(c *Config) {
+			c.Storage = StorageS3
+			c.S3 = S3Config{Endpoint: "s3.example.com", Bucket: "uploads", AccessKey: "access"}
+		}, wantErr: ErrS3Invalid},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := production()
+			if tc.dev {
+				c = Default()
+			}
+			tc.change(&c)
+			if err := c.Validate(); err != tc.wantErr {
+				t.Errorf("Validate() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
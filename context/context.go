@@ -8,7 +8,12 @@ import (
 
 type userCtx string
 
-var u userCtx = "user"
+var (
+	u       userCtx = "user"
+	session userCtx = "session"
+	token   userCtx = "token"
+	csrf    userCtx = "csrf"
+)
 
 // SetUserInContext sets the user in the request context object
 func SetUserInContext(ctx context.Context, user *models.User) context.Context {
@@ -24,3 +29,41 @@ func GetUserFromContext(ctx context.Context) *models.User {
 	}
 	return nil
 }
+
+// SetSessionInContext sets the current session in the request context object
+func SetSessionInContext(ctx context.Context, s *models.Session) context.Context {
+	return context.WithValue(ctx, session, s)
+}
+
+// GetSessionFromContext gets the current session from the context
+func GetSessionFromContext(ctx context.Context) *models.Session {
+	if s, t := ctx.Value(session).(*models.Session); t {
+		return s
+	}
+	return nil
+}
+
+// SetAPITokenInContext sets the api token the request was made with
+func SetAPITokenInContext(ctx context.Context, t *models.APIToken) context.Context {
+	return context.WithValue(ctx, token, t)
+}
+
+// GetAPITokenFromContext gets the api token the request was made with,
+// nil when the request was authenticated by a session cookie
+func GetAPITokenFromContext(ctx context.Context) *models.APIToken {
+	if t, ok := ctx.Value(token).(*models.APIToken); ok {
+		return t
+	}
+	return nil
+}
+
+// SetCSRFTokenInContext sets the token forms must send back
+func SetCSRFTokenInContext(ctx context.Context, t string) context.Context {
+	return context.WithValue(ctx, csrf, t)
+}
+
+// GetCSRFTokenFromContext gets the token forms must send back
+func GetCSRFTokenFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(csrf).(string)
+	return t
+}
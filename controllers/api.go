@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"profile.com/context"
+	"profile.com/export"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// profileResponse defines the public JSON shape of a user profile
+type profileResponse struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name"`
+	Email    string `json:"email,omitempty"`
+	Title    string `json:"title"`
+	Summary  string `json:"summary"`
+	Skills   string `json:"skills"`
+	Avatar   string `json:"avatar_url"`
+}
+
+// userResponse defines the JSON shape of the signed in user
+type userResponse struct {
+	profileResponse
+	Verified         bool      `json:"verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type apiSignupRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type apiLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// apiProfileRequest only updates the fields that are present
+type apiProfileRequest struct {
+	Name     *string `json:"name"`
+	Username *string `json:"username"`
+	Title    *string `json:"title"`
+	Summary  *string `json:"summary"`
+	Skills   *string `json:"skills"`
+}
+
+func newProfileResponse(user *models.User) profileResponse {
+	return profileResponse{
+		ID:       user.ID,
+		Username: user.Username,
+		Name:     user.Name,
+		Email:    user.Email,
+		Title:    user.Title,
+		Summary:  user.Summary,
+		Skills:   user.Skills,
+		Avatar:   user.AvatarURL(256),
+	}
+}
+
+func newUserResponse(user *models.User) userResponse {
+	return userResponse{
+		profileResponse:  newProfileResponse(user),
+		Verified:         user.Verified,
+		TwoFactorEnabled: user.TOTPEnabled,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
+// APIUsers handles GET /api/v1/users. It pages through users with limit
+// and offset or cursor, the total goes in X-Total-Count and the next page
+// in the Link header
+func (u *User) APIUsers(w http.ResponseWriter, r *http.Request) {
+	opts := models.ListOptions{
+		Cursor: FromQuery(r, "cursor"),
+		Sort:   FromQuery(r, "sort"),
+		Desc:   FromQuery(r, "order") == "desc",
+		Filter: models.UserFilter{
+			Name: FromQuery(r, "name"),
+		},
+	}
+	opts.Limit, _ = strconv.Atoi(FromQuery(r, "limit"))
+	opts.Offset, _ = strconv.Atoi(FromQuery(r, "offset"))
+	list, err := u.us.List(opts)
+	if err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	redacted, err := u.redactUsers(r, list.Users)
+	if err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	profiles := make([]profileResponse, 0, len(redacted))
+	for _, user := range redacted {
+		profiles = append(profiles, newProfileResponse(user))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(list.Total))
+	if list.NextCursor != "" {
+		next := *r.URL
+		q := next.Query()
+		q.Del("offset")
+		q.Set("cursor", list.NextCursor)
+		next.RawQuery = q.Encode()
+		w.Header().Set("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+	}
+	views.RenderJSON(w, http.StatusOK, profiles)
+}
+
+// APIUser handles GET /api/v1/users/{id}
+func (u *User) APIUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		renderAPIError(w, models.ErrIDInvalid)
+		return
+	}
+	user, err := u.us.ByID(uint(id))
+	if err != nil {
+		renderAPIError(w, models.ErrNotFound)
+		return
+	}
+	if user, err = u.pfs.Redact(user, viewerFromRequest(r)); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	views.RenderJSON(w, http.StatusOK, newProfileResponse(user))
+}
+
+// APIMe handles GET /api/v1/me
+func (u *User) APIMe(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	views.RenderJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// APIUpdateMe handles PATCH /api/v1/me
+func (u *User) APIUpdateMe(w http.ResponseWriter, r *http.Request) {
+	var req apiProfileRequest
+	if err := parseJSON(r, &req); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	user := context.GetUserFromContext(r.Context())
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+	if req.Title != nil {
+		user.Title = *req.Title
+	}
+	if req.Summary != nil {
+		user.Summary = *req.Summary
+	}
+	if err := u.us.Update(user); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	if req.Skills != nil {
+		if err := u.sks.SetUserSkills(user, models.SplitSkills(*req.Skills)); err != nil {
+			renderAPIError(w, err)
+			return
+		}
+	}
+	views.RenderJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// APISignup handles POST /api/v1/signup
+func (u *User) APISignup(w http.ResponseWriter, r *http.Request) {
+	var req apiSignupRequest
+	if err := parseJSON(r, &req); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	user := models.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	}
+	if err := u.us.Create(&user); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	if err := u.signIn(w, r, &user); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	if err := u.sendVerification(r, &user); err != nil {
+		log.Println(err)
+	}
+	views.RenderJSON(w, http.StatusCreated, newUserResponse(&user))
+}
+
+// APILogin handles POST /api/v1/login. Users with two factor turned on
+// send their code in the same request
+func (u *User) APILogin(w http.ResponseWriter, r *http.Request) {
+	var req apiLoginRequest
+	if err := parseJSON(r, &req); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	user, err := u.authenticate(r, req.Email, req.Password)
+	if err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	if user.TOTPEnabled {
+		if err := u.tfs.Verify(user, req.Code); err != nil {
+			renderAPIError(w, err)
+			return
+		}
+	}
+	if err := u.signIn(w, r, user); err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	views.RenderJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// parseJSON decodes the JSON request body into v
+func parseJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errBadRequest
+	}
+	return nil
+}
+
+// errBadRequest is returned when a request body cannot be decoded
+var errBadRequest = &apiError{
+	status:  http.StatusBadRequest,
+	message: "Request body must be valid JSON",
+}
+
+// apiError is an error that knows its own HTTP status
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// errorStatus maps the models error sentinels to HTTP status codes
+func errorStatus(err error) int {
+	switch err {
+	case models.ErrNotFound:
+		return http.StatusNotFound
+	case models.ErrTooManyAttempts:
+		return http.StatusTooManyRequests
+	case models.ErrInvalidCredentials,
+		models.ErrTwoFactorCodeInvalid:
+		return http.StatusUnauthorized
+	case models.ErrEmailTaken,
+		models.ErrUsernameTaken,
+		models.ErrAlreadyVerified,
+		models.ErrTwoFactorEnabled:
+		return http.StatusConflict
+	case models.ErrNameMissing,
+		models.ErrEmailMissing,
+		models.ErrPasswordTooShort,
+		models.ErrPasswordNotProvided,
+		models.ErrTwoFactorNotEnrolled,
+		models.ErrTokenNameMissing,
+		models.ErrScopeInvalid,
+		models.ErrCompanyMissing,
+		models.ErrRoleMissing,
+		models.ErrSchoolMissing,
+		models.ErrProjectNameMissing,
+		models.ErrURLInvalid,
+		models.ErrStartDateMissing,
+		models.ErrDateInvalid,
+		models.ErrSkillNameMissing,
+		models.ErrSkillLevelInvalid,
+		models.ErrSkillYearsInvalid,
+		models.ErrDateOrder,
+		models.ErrUsernameLength,
+		models.ErrUsernameInvalid,
+		models.ErrVisibilityInvalid,
+		models.ErrSortInvalid,
+		models.ErrAvatarMissing,
+		models.ErrAvatarType:
+		return http.StatusUnprocessableEntity
+	case models.ErrAvatarTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case models.ErrIDInvalid,
+		models.ErrUserIDMissing,
+		models.ErrTokenInvalid,
+		models.ErrCursorInvalid,
+		export.ErrResumeInvalid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// renderAPIError writes err as a JSON error body, hiding the details of
+// anything that is not a known models error
+func renderAPIError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*apiError); ok {
+		views.RenderJSONError(w, e.status, e.message)
+		return
+	}
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Println(err)
+		err = models.ErrInternalServerError
+	}
+	views.RenderJSONError(w, status, strings.TrimPrefix(err.Error(), "models: "))
+}
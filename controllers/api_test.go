@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/config"
+	"profile.com/email"
+	"profile.com/middleware"
+	"profile.com/models"
+)
+
+// fakeLoginService accepts one password for a user with two factor on
+type fakeLoginService struct {
+	models.LoginService
+	user *models.User
+}
+
+func (ls *fakeLoginService) Authenticate(user *models.User, ip string) (*models.User, error) {
+	if user.Email != ls.user.Email || user.Password != "correct horse" {
+		return nil, models.ErrInvalidCredentials
+	}
+	return ls.user, nil
+}
+
+// fakeTwoFactorService rejects every code and, like the real service,
+// stops checking them once limit wrong codes have been given
+type fakeTwoFactorService struct {
+	models.TwoFactorService
+	limit int
+	wrong int
+}
+
+func (tfs *fakeTwoFactorService) Verify(user *models.User, code string) error {
+	if tfs.wrong >= tfs.limit {
+		return models.ErrTooManyAttempts
+	}
+	tfs.wrong++
+	return models.ErrTwoFactorCodeInvalid
+}
+
+func TestAPILoginTwoFactorThrottled(t *testing.T) {
+	const limit = 4
+	user := &models.User{
+		Model:       gorm.Model{ID: 1},
+		Name:        "Ada",
+		Email:       "ada@example.com",
+		TOTPEnabled: true,
+	}
+	services := &models.Services{
+		Login:     &fakeLoginService{user: user},
+		Session:   &fakeSessionService{},
+		TwoFactor: &fakeTwoFactorService{limit: limit},
+	}
+	c := NewUser(services, email.NewOutbox(), middleware.NewCookies(config.CookieConfig{}), testBaseURL)
+
+	login := func() *httptest.ResponseRecorder {
+		body := `{"email": "ada@example.com", "password": "correct horse", "code": "123456"}`
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c.APILogin(w, r)
+		return w
+	}
+	for i := 1; i <= limit; i++ {
+		if w := login(); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status = %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := login()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("wrong code %d: status = %d, want %d", limit+1, w.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(w.Body.String(), "Too many failed login attempts") {
+		t.Errorf("body = %s, want the too many attempts error", w.Body.String())
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("throttled login set cookies %v", cookies)
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// tokensPage defines the shape of the api tokens page
+type tokensPage struct {
+	Tokens   []models.APIToken
+	Scopes   []string
+	NewToken string
+}
+
+type tokenForm struct {
+	Name       string   `schema:"name"`
+	Scopes     []string `schema:"scopes"`
+	ExpiryDays int      `schema:"expiry_days"`
+}
+
+// Tokens renders the user's api tokens
+func (u *User) Tokens(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	u.renderTokens(w, r, data, "")
+}
+
+// CreateToken mints a new api token and shows it once
+func (u *User) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var form tokenForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	token := models.APIToken{
+		UserID: user.ID,
+		Name:   form.Name,
+		Scopes: strings.Join(form.Scopes, ","),
+	}
+	if form.ExpiryDays > 0 {
+		expires := time.Now().AddDate(0, 0, form.ExpiryDays)
+		token.ExpiresAt = &expires
+	}
+	if err := u.ats.Create(&token); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.renderTokens(w, r, data, "")
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "Copy your new token now, it will not be shown again")
+	u.renderTokens(w, r, data, token.Token)
+}
+
+// RevokeToken deletes one of the user's api tokens
+func (u *User) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := u.ats.Revoke(user.ID, uint(id)); err != nil {
+		if err == models.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/tokens", http.StatusFound)
+}
+
+func (u *User) renderTokens(w http.ResponseWriter, r *http.Request, data views.Data, newToken string) {
+	user := context.GetUserFromContext(r.Context())
+	tokens, err := u.ats.ByUser(user.ID)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+	}
+	data.Yield = tokensPage{
+		Tokens:   tokens,
+		Scopes:   models.APITokenScopes,
+		NewToken: newToken,
+	}
+	u.TokensView.Render(w, r, data)
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"profile.com/avatar"
+	"profile.com/context"
+	"profile.com/identicon"
+	"profile.com/models"
+	"profile.com/storage"
+)
+
+const (
+	// identiconDefaultSize is the width of an identicon PNG when none is
+	// asked for
+	identiconDefaultSize = 256
+	identiconMinSize     = 16
+	identiconMaxSize     = 1024
+)
+
+// UploadAvatar handles POST /dashboard/avatar
+func (u *User) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	// leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, avatar.MaxUploadSize+1<<16)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			err = models.ErrAvatarTooLarge
+		case err == http.ErrMissingFile, err == http.ErrNotMultipart:
+			err = models.ErrAvatarMissing
+		}
+		u.dashboardError(w, r, err)
+		return
+	}
+	defer file.Close()
+	if err := u.avs.Upload(user, file); err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// RemoveAvatar handles POST /dashboard/avatar/delete
+func (u *User) RemoveAvatar(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if err := u.avs.Remove(user); err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// Avatar handles GET /avatars/{id}/{file}. Avatar file names change with
+// their content, so they can be cached for good
+func (u *User) Avatar(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	rc, info, err := u.avs.Open(key)
+	if err != nil {
+		if err != storage.ErrNotFound && err != storage.ErrKeyInvalid {
+			log.Println(err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer rc.Close()
+
+	etag := `"` + key[strings.LastIndex(key, "/")+1:] + `"`
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Println(err)
+	}
+}
+
+// Identicon handles GET /avatar/{id}.svg and /avatar/{id}.png, the
+// generated picture of users who have not uploaded one. ?size= sets the
+// width of the PNG
+func (u *User) Identicon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	icon := identicon.ForUser(uint(id))
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	if vars["ext"] == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(icon.SVG()))
+		return
+	}
+	size, _ := strconv.Atoi(FromQuery(r, "size"))
+	if size == 0 {
+		size = identiconDefaultSize
+	}
+	if size < identiconMinSize {
+		size = identiconMinSize
+	}
+	if size > identiconMaxSize {
+		size = identiconMaxSize
+	}
+	png, err := icon.PNG(size)
+	if err != nil {
+		log.Println(err)
+		w.Header().Del("Cache-Control")
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
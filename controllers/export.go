@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"profile.com/context"
+	"profile.com/export"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// maxResumeSize caps the size of an imported JSON Resume document
+const maxResumeSize = 1 << 20
+
+// PublicResume handles GET /u/{username}/resume.json, the profile as a
+// JSON Resume document with only the fields the viewer may see
+func (u *User) PublicResume(w http.ResponseWriter, r *http.Request) {
+	user := u.publicUser(w, r, "/resume.json")
+	if user == nil {
+		return
+	}
+	u.renderResume(w, r, user, viewerFromRequest(r))
+}
+
+// DashboardResume handles GET /dashboard/resume.json, the full profile of
+// the signed in user as a JSON Resume document
+func (u *User) DashboardResume(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	u.renderResume(w, r, user, models.Viewer{User: user})
+}
+
+// PublicResumePDF handles GET /u/{username}/resume.pdf, the profile as a
+// PDF with only the fields the viewer may see. ?theme= picks the look
+func (u *User) PublicResumePDF(w http.ResponseWriter, r *http.Request) {
+	user := u.publicUser(w, r, "/resume.pdf")
+	if user == nil {
+		return
+	}
+	u.renderResumePDF(w, r, user, viewerFromRequest(r))
+}
+
+// DashboardResumePDF handles GET /dashboard/resume.pdf, the full profile
+// of the signed in user as a PDF
+func (u *User) DashboardResumePDF(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	u.renderResumePDF(w, r, user, models.Viewer{User: user})
+}
+
+// ImportResume handles POST /dashboard/import, filling in the profile from
+// an uploaded JSON Resume document
+func (u *User) ImportResume(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	r.Body = http.MaxBytesReader(w, r.Body, maxResumeSize)
+	// the CSRF middleware may have parsed the form under its own, larger
+	// limit already
+	file, header, err := r.FormFile("resume")
+	if err != nil || header.Size > maxResumeSize {
+		if file != nil {
+			file.Close()
+		}
+		u.dashboardError(w, r, export.ErrResumeInvalid)
+		return
+	}
+	defer file.Close()
+
+	resume, err := export.ParseJSONResume(file)
+	if err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	profile, err := resume.Profile()
+	if err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	if err := u.pfs.Import(user, profile); err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+func (u *User) renderResume(w http.ResponseWriter, r *http.Request, owner *models.User, viewer models.Viewer) {
+	profile, err := u.pfs.View(owner, viewer)
+	if err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	var url string
+	if owner.Username != "" {
+		url = u.absoluteURL("/u/" + owner.Username)
+	}
+	views.RenderJSON(w, http.StatusOK, export.JSONResume(profile, url))
+}
+
+func (u *User) renderResumePDF(w http.ResponseWriter, r *http.Request, owner *models.User, viewer models.Viewer) {
+	profile, err := u.pfs.View(owner, viewer)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	var url string
+	if owner.Username != "" {
+		url = u.absoluteURL("/u/" + owner.Username)
+	}
+	var buf bytes.Buffer
+	theme := export.PDFThemeByName(FromQuery(r, "theme"))
+	if err := export.PDF(&buf, profile, url, theme); err != nil {
+		log.Println(err)
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	filename := "resume.pdf"
+	if owner.Username != "" {
+		filename = owner.Username + ".pdf"
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Write(buf.Bytes())
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"net"
 	"net/http"
 
 	"github.com/gorilla/schema"
@@ -20,6 +21,15 @@ func FromQuery(r *http.Request, key string) string {
 	return r.FormValue(key)
 }
 
+// ClientIP returns the IP address the request came from
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // // GetCookies gets the cookies from the request
 // func GetCookies(r *http.Request, name string) (*http.Cookie, error) {
 // 	cookie, err := r.Cookie(name)
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// peoplePage defines the shape of the people directory page
+type peoplePage struct {
+	Query  models.SearchQuery
+	Result *models.SearchResult
+	Users  []*models.User
+	Sorts  []string
+}
+
+// PrevURL links to the page before the current one
+func (p peoplePage) PrevURL() string {
+	return p.pageURL(p.Result.Page - 1)
+}
+
+// NextURL links to the page after the current one
+func (p peoplePage) NextURL() string {
+	return p.pageURL(p.Result.Page + 1)
+}
+
+func (p peoplePage) pageURL(page int) string {
+	v := url.Values{}
+	v.Set("q", p.Query.Text)
+	v.Set("skill", p.Query.Skill)
+	v.Set("title", p.Query.Title)
+	v.Set("sort", p.Query.Sort)
+	v.Set("page", strconv.Itoa(page))
+	return "/people?" + v.Encode()
+}
+
+// peopleResponse defines the JSON shape of a page of the directory
+type peopleResponse struct {
+	People  []profileResponse `json:"people"`
+	Total   int               `json:"total"`
+	Page    int               `json:"page"`
+	PerPage int               `json:"per_page"`
+}
+
+// People handles GET /people, the searchable directory of public profiles
+func (u *User) People(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	query := models.SearchQuery{
+		Text:  FromQuery(r, "q"),
+		Skill: FromQuery(r, "skill"),
+		Title: FromQuery(r, "title"),
+		Sort:  FromQuery(r, "sort"),
+	}
+	query.Page, _ = strconv.Atoi(FromQuery(r, "page"))
+	query.PerPage, _ = strconv.Atoi(FromQuery(r, "per_page"))
+
+	page := peoplePage{Query: query, Sorts: models.SearchSorts}
+	result, err := u.srs.Search(query)
+	if err == nil {
+		page.Result = result
+		page.Users, err = u.redactUsers(r, result.Users)
+	}
+	if err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
+		if errorStatus(err) == http.StatusInternalServerError {
+			log.Println(err)
+			err = models.ErrInternalServerError
+		}
+		data.SetAlert(views.ErrLevelDanger, err)
+		page.Result = &models.SearchResult{}
+	}
+
+	if views.WantsJSON(r) {
+		res := peopleResponse{
+			People:  make([]profileResponse, 0, len(page.Users)),
+			Total:   result.Total,
+			Page:    result.Page,
+			PerPage: result.PerPage,
+		}
+		for _, user := range page.Users {
+			res.People = append(res.People, newProfileResponse(user))
+		}
+		views.RenderJSON(w, http.StatusOK, res)
+		return
+	}
+	data.Yield = page
+	u.PeopleView.Render(w, r, data)
+}
+
+// redactUsers hides what the viewer may not see of every user in users
+func (u *User) redactUsers(r *http.Request, users []models.User) ([]*models.User, error) {
+	viewer := viewerFromRequest(r)
+	redacted := make([]*models.User, 0, len(users))
+	for i := range users {
+		user, err := u.pfs.Redact(&users[i], viewer)
+		if err != nil {
+			return nil, err
+		}
+		redacted = append(redacted, user)
+	}
+	return redacted, nil
+}
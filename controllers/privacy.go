@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// privacyPage defines the shape of the privacy settings page
+type privacyPage struct {
+	Fields       []privacyField
+	Visibilities []models.Visibility
+	ShareURL     string
+}
+
+// privacyField is one row of the privacy settings form
+type privacyField struct {
+	Label string
+	Name  string
+	Value models.Visibility
+}
+
+type privacyForm struct {
+	Email      models.Visibility `schema:"email"`
+	Title      models.Visibility `schema:"title"`
+	Summary    models.Visibility `schema:"summary"`
+	Skills     models.Visibility `schema:"skills"`
+	Experience models.Visibility `schema:"experience"`
+	Education  models.Visibility `schema:"education"`
+	Projects   models.Visibility `schema:"projects"`
+}
+
+// Privacy renders the profile visibility settings
+func (u *User) Privacy(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	visibility, err := u.vs.ByUser(user.ID)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		visibility = models.DefaultProfileVisibility(user.ID)
+	}
+	u.renderPrivacy(w, r, data, visibility)
+}
+
+// UpdatePrivacy saves the profile visibility settings
+func (u *User) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	var form privacyForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	visibility, err := u.vs.ByUser(user.ID)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		u.renderPrivacy(w, r, data, models.DefaultProfileVisibility(user.ID))
+		return
+	}
+	visibility.Email = form.Email
+	visibility.Title = form.Title
+	visibility.Summary = form.Summary
+	visibility.Skills = form.Skills
+	visibility.Experience = form.Experience
+	visibility.Education = form.Education
+	visibility.Projects = form.Projects
+	if err := u.vs.Update(visibility); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.renderPrivacy(w, r, data, visibility)
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "Your privacy settings were saved")
+	u.renderPrivacy(w, r, data, visibility)
+}
+
+// RegenerateShareLink replaces the profile share link, the old one stops
+// working
+func (u *User) RegenerateShareLink(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	visibility, err := u.vs.RegenerateShareToken(user.ID)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		visibility = models.DefaultProfileVisibility(user.ID)
+	}
+	u.renderPrivacy(w, r, data, visibility)
+}
+
+func (u *User) renderPrivacy(w http.ResponseWriter, r *http.Request, data views.Data,
+	visibility *models.ProfileVisibility) {
+	user := context.GetUserFromContext(r.Context())
+	page := privacyPage{
+		Fields: []privacyField{
+			{"Email", "email", visibility.Email},
+			{"Title", "title", visibility.Title},
+			{"Summary", "summary", visibility.Summary},
+			{"Skills", "skills", visibility.Skills},
+			{"Experience", "experience", visibility.Experience},
+			{"Education", "education", visibility.Education},
+			{"Projects", "projects", visibility.Projects},
+		},
+		Visibilities: models.Visibilities,
+	}
+	if user.Username != "" && visibility.ShareToken != "" {
+		page.ShareURL = u.absoluteURL("/u/" + user.Username + "?share=" + url.QueryEscape(visibility.ShareToken))
+	}
+	data.Yield = page
+	u.PrivacyView.Render(w, r, data)
+}
@@ -0,0 +1,482 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// monthFormat is the layout of the month inputs on the section forms
+const monthFormat = "2006-01"
+
+// Sections defines the shape of the profile sections controller
+type Sections struct {
+	ExperienceView *views.Views
+	EducationView  *views.Views
+	ProjectView    *views.Views
+	es             models.ExperienceService
+	eds            models.EducationService
+	ps             models.ProjectService
+}
+
+type experienceForm struct {
+	ID          uint   `schema:"-"`
+	Company     string `schema:"company"`
+	Role        string `schema:"role"`
+	StartDate   string `schema:"start_date"`
+	EndDate     string `schema:"end_date"`
+	Description string `schema:"description"`
+}
+
+type educationForm struct {
+	ID          uint   `schema:"-"`
+	School      string `schema:"school"`
+	Degree      string `schema:"degree"`
+	Field       string `schema:"field"`
+	StartDate   string `schema:"start_date"`
+	EndDate     string `schema:"end_date"`
+	Description string `schema:"description"`
+}
+
+type projectForm struct {
+	ID          uint   `schema:"-"`
+	Name        string `schema:"name"`
+	URL         string `schema:"url"`
+	Description string `schema:"description"`
+	Tech        string `schema:"tech"`
+}
+
+type moveForm struct {
+	Direction string `schema:"direction"`
+}
+
+// NewSections returns the sections struct
+func NewSections(services *models.Services) *Sections {
+	return &Sections{
+		ExperienceView: views.NewView("bootstrap", "sections/experience"),
+		EducationView:  views.NewView("bootstrap", "sections/education"),
+		ProjectView:    views.NewView("bootstrap", "sections/project"),
+		es:             services.Experience,
+		eds:            services.Education,
+		ps:             services.Project,
+	}
+}
+
+// ##################### Experience ################################ //
+
+// NewExperience renders the form to add work experience
+func (s *Sections) NewExperience(w http.ResponseWriter, r *http.Request) {
+	s.ExperienceView.Render(w, r, experienceForm{})
+}
+
+// CreateExperience adds work experience to the profile
+func (s *Sections) CreateExperience(w http.ResponseWriter, r *http.Request) {
+	var form experienceForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	experience := models.Experience{UserID: user.ID}
+	err := form.apply(&experience)
+	if err == nil {
+		err = s.es.Create(&experience)
+	}
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.ExperienceView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// EditExperience renders the form to edit work experience
+func (s *Sections) EditExperience(w http.ResponseWriter, r *http.Request) {
+	experience, err := s.experienceByID(w, r)
+	if err != nil {
+		return
+	}
+	s.ExperienceView.Render(w, r, newExperienceForm(experience))
+}
+
+// UpdateExperience saves changes to work experience
+func (s *Sections) UpdateExperience(w http.ResponseWriter, r *http.Request) {
+	experience, err := s.experienceByID(w, r)
+	if err != nil {
+		return
+	}
+	var form experienceForm
+	var data views.Data
+	ParseForm(r, &form)
+	form.ID = experience.ID
+
+	err = form.apply(experience)
+	if err == nil {
+		err = s.es.Update(experience)
+	}
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.ExperienceView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// DeleteExperience removes work experience from the profile
+func (s *Sections) DeleteExperience(w http.ResponseWriter, r *http.Request) {
+	experience, err := s.experienceByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.es.Delete(experience.ID); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// MoveExperience moves work experience up or down the profile
+func (s *Sections) MoveExperience(w http.ResponseWriter, r *http.Request) {
+	experience, err := s.experienceByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.es.Move(experience, movingUp(r)); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// experienceByID looks up the experience in the URL and makes sure it
+// belongs to the signed in user, writing a 404 when it does not
+func (s *Sections) experienceByID(w http.ResponseWriter, r *http.Request) (*models.Experience, error) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := idFromVars(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, err
+	}
+	experience, err := s.es.ByID(id)
+	if err != nil || experience.UserID != user.ID {
+		http.NotFound(w, r)
+		return nil, models.ErrNotFound
+	}
+	return experience, nil
+}
+
+func newExperienceForm(e *models.Experience) experienceForm {
+	return experienceForm{
+		ID:          e.ID,
+		Company:     e.Company,
+		Role:        e.Role,
+		StartDate:   formatMonth(&e.StartDate),
+		EndDate:     formatMonth(e.EndDate),
+		Description: e.Description,
+	}
+}
+
+func (f experienceForm) apply(e *models.Experience) error {
+	start, end, err := parseMonthRange(f.StartDate, f.EndDate)
+	if err != nil {
+		return err
+	}
+	e.Company = f.Company
+	e.Role = f.Role
+	e.StartDate = start
+	e.EndDate = end
+	e.Description = f.Description
+	return nil
+}
+
+// ##################### Education ################################ //
+
+// NewEducation renders the form to add education
+func (s *Sections) NewEducation(w http.ResponseWriter, r *http.Request) {
+	s.EducationView.Render(w, r, educationForm{})
+}
+
+// CreateEducation adds education to the profile
+func (s *Sections) CreateEducation(w http.ResponseWriter, r *http.Request) {
+	var form educationForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	education := models.Education{UserID: user.ID}
+	err := form.apply(&education)
+	if err == nil {
+		err = s.eds.Create(&education)
+	}
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.EducationView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// EditEducation renders the form to edit education
+func (s *Sections) EditEducation(w http.ResponseWriter, r *http.Request) {
+	education, err := s.educationByID(w, r)
+	if err != nil {
+		return
+	}
+	s.EducationView.Render(w, r, newEducationForm(education))
+}
+
+// UpdateEducation saves changes to education
+func (s *Sections) UpdateEducation(w http.ResponseWriter, r *http.Request) {
+	education, err := s.educationByID(w, r)
+	if err != nil {
+		return
+	}
+	var form educationForm
+	var data views.Data
+	ParseForm(r, &form)
+	form.ID = education.ID
+
+	err = form.apply(education)
+	if err == nil {
+		err = s.eds.Update(education)
+	}
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.EducationView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// DeleteEducation removes education from the profile
+func (s *Sections) DeleteEducation(w http.ResponseWriter, r *http.Request) {
+	education, err := s.educationByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.eds.Delete(education.ID); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// MoveEducation moves education up or down the profile
+func (s *Sections) MoveEducation(w http.ResponseWriter, r *http.Request) {
+	education, err := s.educationByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.eds.Move(education, movingUp(r)); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// educationByID looks up the education in the URL and makes sure it
+// belongs to the signed in user, writing a 404 when it does not
+func (s *Sections) educationByID(w http.ResponseWriter, r *http.Request) (*models.Education, error) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := idFromVars(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, err
+	}
+	education, err := s.eds.ByID(id)
+	if err != nil || education.UserID != user.ID {
+		http.NotFound(w, r)
+		return nil, models.ErrNotFound
+	}
+	return education, nil
+}
+
+func newEducationForm(e *models.Education) educationForm {
+	return educationForm{
+		ID:          e.ID,
+		School:      e.School,
+		Degree:      e.Degree,
+		Field:       e.Field,
+		StartDate:   formatMonth(&e.StartDate),
+		EndDate:     formatMonth(e.EndDate),
+		Description: e.Description,
+	}
+}
+
+func (f educationForm) apply(e *models.Education) error {
+	start, end, err := parseMonthRange(f.StartDate, f.EndDate)
+	if err != nil {
+		return err
+	}
+	e.School = f.School
+	e.Degree = f.Degree
+	e.Field = f.Field
+	e.StartDate = start
+	e.EndDate = end
+	e.Description = f.Description
+	return nil
+}
+
+// ##################### Projects ################################ //
+
+// NewProject renders the form to add a project
+func (s *Sections) NewProject(w http.ResponseWriter, r *http.Request) {
+	s.ProjectView.Render(w, r, projectForm{})
+}
+
+// CreateProject adds a project to the profile
+func (s *Sections) CreateProject(w http.ResponseWriter, r *http.Request) {
+	var form projectForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	project := models.Project{UserID: user.ID}
+	form.apply(&project)
+	if err := s.ps.Create(&project); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.ProjectView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// EditProject renders the form to edit a project
+func (s *Sections) EditProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projectByID(w, r)
+	if err != nil {
+		return
+	}
+	s.ProjectView.Render(w, r, newProjectForm(project))
+}
+
+// UpdateProject saves changes to a project
+func (s *Sections) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projectByID(w, r)
+	if err != nil {
+		return
+	}
+	var form projectForm
+	var data views.Data
+	ParseForm(r, &form)
+	form.ID = project.ID
+
+	form.apply(project)
+	if err := s.ps.Update(project); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form
+		s.ProjectView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// DeleteProject removes a project from the profile
+func (s *Sections) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projectByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.ps.Delete(project.ID); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// MoveProject moves a project up or down the profile
+func (s *Sections) MoveProject(w http.ResponseWriter, r *http.Request) {
+	project, err := s.projectByID(w, r)
+	if err != nil {
+		return
+	}
+	if err := s.ps.Move(project, movingUp(r)); err != nil {
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// projectByID looks up the project in the URL and makes sure it belongs
+// to the signed in user, writing a 404 when it does not
+func (s *Sections) projectByID(w http.ResponseWriter, r *http.Request) (*models.Project, error) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := idFromVars(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, err
+	}
+	project, err := s.ps.ByID(id)
+	if err != nil || project.UserID != user.ID {
+		http.NotFound(w, r)
+		return nil, models.ErrNotFound
+	}
+	return project, nil
+}
+
+func newProjectForm(p *models.Project) projectForm {
+	return projectForm{
+		ID:          p.ID,
+		Name:        p.Name,
+		URL:         p.URL,
+		Description: p.Description,
+		Tech:        p.Tech,
+	}
+}
+
+func (f projectForm) apply(p *models.Project) {
+	p.Name = f.Name
+	p.URL = f.URL
+	p.Description = f.Description
+	p.Tech = f.Tech
+}
+
+// ##################### Helpers ################################ //
+
+// idFromVars reads the {id} route variable
+func idFromVars(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, models.ErrIDInvalid
+	}
+	return uint(id), nil
+}
+
+// movingUp reports whether the move form asked to move the item up
+func movingUp(r *http.Request) bool {
+	var form moveForm
+	ParseForm(r, &form)
+	return form.Direction == "up"
+}
+
+// parseMonthRange parses the start and optional end month inputs
+func parseMonthRange(start, end string) (time.Time, *time.Time, error) {
+	if strings.TrimSpace(start) == "" {
+		return time.Time{}, nil, models.ErrStartDateMissing
+	}
+	s, err := time.Parse(monthFormat, strings.TrimSpace(start))
+	if err != nil {
+		return time.Time{}, nil, models.ErrDateInvalid
+	}
+	if strings.TrimSpace(end) == "" {
+		return s, nil, nil
+	}
+	e, err := time.Parse(monthFormat, strings.TrimSpace(end))
+	if err != nil {
+		return time.Time{}, nil, models.ErrDateInvalid
+	}
+	return s, &e, nil
+}
+
+func formatMonth(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(monthFormat)
+}
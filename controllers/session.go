@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// device defines the shape of a session shown on the devices page
+type device struct {
+	ID         uint
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Current    bool
+}
+
+// Logout ends the current session
+func (u *User) Logout(w http.ResponseWriter, r *http.Request) {
+	if session := context.GetSessionFromContext(r.Context()); session != nil {
+		if err := u.ss.Delete(session.ID); err != nil {
+			log.Println(err)
+		}
+	}
+	u.cookies.ClearSession(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// LogoutAll ends every session the user has on any device
+func (u *User) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if err := u.ss.DeleteByUser(user.ID); err != nil {
+		log.Println(err)
+	}
+	u.cookies.ClearSession(w)
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
+
+// Devices renders the list of active sessions
+func (u *User) Devices(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	current := context.GetSessionFromContext(r.Context())
+
+	sessions, err := u.ss.ByUser(user.ID)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		u.DevicesView.Render(w, r, data)
+		return
+	}
+	devices := make([]device, 0, len(sessions))
+	for _, s := range sessions {
+		devices = append(devices, device{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			Current:    current != nil && current.ID == s.ID,
+		})
+	}
+	data.Yield = devices
+	u.DevicesView.Render(w, r, data)
+}
+
+// RevokeDevice ends one of the user's sessions
+func (u *User) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := u.ss.Revoke(user.ID, uint(id)); err != nil {
+		if err == models.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		log.Println(err)
+	}
+	if current := context.GetSessionFromContext(r.Context()); current != nil && current.ID == uint(id) {
+		u.cookies.ClearSession(w)
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/devices", http.StatusFound)
+}
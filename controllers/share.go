@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"profile.com/export"
+	"profile.com/models"
+	"profile.com/qr"
+)
+
+const (
+	// qrDefaultSize is the width of a QR code PNG when none is asked for
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 1024
+)
+
+// VCard handles GET /u/{username}.vcf, the profile as a contact card
+func (u *User) VCard(w http.ResponseWriter, r *http.Request) {
+	user := u.publicUser(w, r, ".vcf")
+	if user == nil {
+		return
+	}
+	card, err := u.vCard(r, user)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+user.Username+`.vcf"`)
+	w.Write([]byte(card))
+}
+
+// QRCodeSVG handles GET /u/{username}/qr.svg
+func (u *User) QRCodeSVG(w http.ResponseWriter, r *http.Request) {
+	u.qrCode(w, r, "svg")
+}
+
+// QRCodePNG handles GET /u/{username}/qr.png, ?size= sets the width
+func (u *User) QRCodePNG(w http.ResponseWriter, r *http.Request) {
+	u.qrCode(w, r, "png")
+}
+
+// qrCode renders a QR code of the profile URL, or of the vCard when
+// ?content=vcard
+func (u *User) qrCode(w http.ResponseWriter, r *http.Request, format string) {
+	user := u.publicUser(w, r, "/qr."+format)
+	if user == nil {
+		return
+	}
+	content := u.absoluteURL("/u/" + user.Username)
+	if FromQuery(r, "content") == "vcard" {
+		card, err := u.vCard(r, user)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+			return
+		}
+		content = card
+	}
+
+	var body []byte
+	var err error
+	switch format {
+	case "svg":
+		var svg string
+		svg, err = qr.SVG(content)
+		body = []byte(svg)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	default:
+		size, _ := strconv.Atoi(FromQuery(r, "size"))
+		if size == 0 {
+			size = qrDefaultSize
+		}
+		if size < qrMinSize {
+			size = qrMinSize
+		}
+		if size > qrMaxSize {
+			size = qrMaxSize
+		}
+		body, err = qr.PNG(content, size)
+		w.Header().Set("Content-Type", "image/png")
+	}
+	if err != nil {
+		log.Println(err)
+		w.Header().Del("Content-Type")
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(body)
+}
+
+// vCard builds the contact card of user with only what the viewer may see
+func (u *User) vCard(r *http.Request, user *models.User) (string, error) {
+	profile, err := u.pfs.View(user, viewerFromRequest(r))
+	if err != nil {
+		return "", err
+	}
+	return export.VCard(profile, u.absoluteURL("/u/"+user.Username)), nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+type skillForm struct {
+	Name  string `schema:"name"`
+	Level int    `schema:"level"`
+	Years int    `schema:"years"`
+}
+
+// skillSuggestion defines the JSON shape of an autocomplete suggestion
+type skillSuggestion struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// AddSkill adds a skill to the profile, or updates it when the user
+// already has it
+func (u *User) AddSkill(w http.ResponseWriter, r *http.Request) {
+	var form skillForm
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	if _, err := u.sks.AddUserSkill(user, form.Name, form.Level, form.Years); err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// UpdateSkill changes the level and years of one of the user's skills
+func (u *User) UpdateSkill(w http.ResponseWriter, r *http.Request) {
+	var form skillForm
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	id, err := idFromVars(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	us, err := u.sks.UserSkillByID(id)
+	if err != nil || us.UserID != user.ID {
+		http.NotFound(w, r)
+		return
+	}
+	us.Level = form.Level
+	us.Years = form.Years
+	if err := u.sks.UpdateUserSkill(us); err != nil {
+		u.dashboardError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// DeleteSkill removes a skill from the profile
+func (u *User) DeleteSkill(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	id, err := idFromVars(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := u.sks.RemoveUserSkill(user, id); err != nil {
+		if err == models.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		log.Println(err)
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// SuggestSkills handles GET /api/skills/suggest?q= for autocomplete
+func (u *User) SuggestSkills(w http.ResponseWriter, r *http.Request) {
+	skills, err := u.sks.Suggest(FromQuery(r, "q"), 10)
+	if err != nil {
+		renderAPIError(w, err)
+		return
+	}
+	suggestions := make([]skillSuggestion, 0, len(skills))
+	for _, skill := range skills {
+		suggestions = append(suggestions, skillSuggestion{
+			ID:   skill.ID,
+			Name: skill.Name,
+		})
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	views.RenderJSON(w, http.StatusOK, suggestions)
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"profile.com/context"
+	"profile.com/middleware"
+	"profile.com/models"
+	"profile.com/qr"
+	"profile.com/totp"
+	"profile.com/views"
+)
+
+// twoFactorSetup defines the shape of the two factor settings page
+type twoFactorSetup struct {
+	Enabled bool
+	Secret  string
+	QRCode  template.HTML
+}
+
+type codeForm struct {
+	Code string `schema:"code"`
+}
+
+// TwoFactor renders the two factor settings page. While two factor is
+// off it shows the pending secret, if enrolment was started
+func (u *User) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		data.Yield = twoFactorSetup{Enabled: user.TOTPEnabled}
+		u.TwoFactorView.Render(w, r, data)
+		return
+	}
+	u.renderTwoFactorSetup(w, r, data, user.Email, user.TOTPSecret)
+}
+
+// SetupTwoFactor starts enrolment with a new secret, replacing any
+// pending one
+func (u *User) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	if _, err := u.tfs.Enroll(user); err != nil {
+		if err != models.ErrTwoFactorEnabled {
+			log.Println(err)
+			err = models.ErrInternalServerError
+		}
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = twoFactorSetup{Enabled: user.TOTPEnabled}
+		u.TwoFactorView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/2fa", http.StatusFound)
+}
+
+// TwoFactorQR serves the enrolment QR code as a PNG for apps and
+// browsers that cannot use the inline SVG
+func (u *User) TwoFactorQR(w http.ResponseWriter, r *http.Request) {
+	user := context.GetUserFromContext(r.Context())
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		http.NotFound(w, r)
+		return
+	}
+	uri := totp.URI(models.TwoFactorIssuer, user.Email, user.TOTPSecret)
+	png, err := qr.PNG(uri, 256)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, models.ErrInternalServerError.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// EnableTwoFactor checks the first code from the app and turns two factor on
+func (u *User) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var form codeForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	codes, err := u.tfs.Enable(user, form.Code)
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.renderTwoFactorSetup(w, r, data, user.Email, user.TOTPSecret)
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "Two factor authentication is now on")
+	data.Yield = codes
+	u.RecoveryCodesView.Render(w, r, data)
+}
+
+// DisableTwoFactor turns two factor off
+func (u *User) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var form codeForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	if err := u.tfs.Disable(user, form.Code); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = twoFactorSetup{Enabled: user.TOTPEnabled}
+		u.TwoFactorView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+func (u *User) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var form codeForm
+	var data views.Data
+	ParseForm(r, &form)
+	user := context.GetUserFromContext(r.Context())
+
+	codes, err := u.tfs.RegenerateRecoveryCodes(user, form.Code)
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = twoFactorSetup{Enabled: user.TOTPEnabled}
+		u.TwoFactorView.Render(w, r, data)
+		return
+	}
+	data.Yield = codes
+	u.RecoveryCodesView.Render(w, r, data)
+}
+
+// LoginTwoFactor renders the second login step
+func (u *User) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie(middleware.PendingTwoFactorCookie); err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	u.LoginTwoFactorView.Render(w, r, nil)
+}
+
+// HandleLoginTwoFactor checks the code and finishes signing the user in
+func (u *User) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var form codeForm
+	var data views.Data
+	ParseForm(r, &form)
+
+	cookie, err := r.Cookie(middleware.PendingTwoFactorCookie)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	user, err := u.tfs.VerifyPending(cookie.Value, form.Code)
+	switch err {
+	case nil:
+	case models.ErrTwoFactorCodeInvalid, models.ErrTooManyAttempts:
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.LoginTwoFactorView.Render(w, r, data)
+		return
+	case models.ErrTokenInvalid, models.ErrTwoFactorChallengeFailed:
+		u.cookies.ClearPendingTwoFactor(w)
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.LoginView.Render(w, r, data)
+		return
+	default:
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		u.LoginTwoFactorView.Render(w, r, data)
+		return
+	}
+	u.cookies.ClearPendingTwoFactor(w)
+	if err := u.signIn(w, r, user); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.LoginView.Render(w, r, data)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// startTwoFactorLogin remembers that the password step passed and sends
+// the user on to enter their code
+func (u *User) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	token, err := u.tfs.PendingToken(user)
+	if err != nil {
+		log.Println(err)
+		if views.WantsJSON(r) {
+			renderAPIError(w, models.ErrInternalServerError)
+			return
+		}
+		var data views.Data
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		u.LoginView.Render(w, r, data)
+		return
+	}
+	u.cookies.SetPendingTwoFactor(w, token, time.Now().Add(models.TwoFactorPendingExpiry))
+	if views.WantsJSON(r) {
+		views.RenderJSON(w, http.StatusAccepted, map[string]bool{"two_factor_required": true})
+		return
+	}
+	http.Redirect(w, r, "/login/2fa", http.StatusFound)
+}
+
+func (u *User) renderTwoFactorSetup(w http.ResponseWriter, r *http.Request, data views.Data, account, secret string) {
+	svg, err := qr.SVG(totp.URI(models.TwoFactorIssuer, account, secret))
+	if err != nil {
+		log.Println(err)
+	}
+	data.Yield = twoFactorSetup{
+		Secret: secret,
+		// The SVG comes from our own encoder, not from user input
+		QRCode: template.HTML(svg),
+	}
+	u.TwoFactorView.Render(w, r, data)
+}
@@ -2,9 +2,16 @@ package controllers
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
 
 	"profile.com/context"
+	"profile.com/email"
+	"profile.com/export"
+	"profile.com/middleware"
 	"profile.com/models"
 
 	"profile.com/views"
@@ -16,7 +23,32 @@ type User struct {
 	LoginView           *views.Views
 	CompleteProfileView *views.Views
 	DashboardView       *views.Views
+	PublicView          *views.Views
+	ForgotView          *views.Views
+	ResetView           *views.Views
+	VerifyView          *views.Views
+	DevicesView         *views.Views
+	TwoFactorView       *views.Views
+	RecoveryCodesView   *views.Views
+	LoginTwoFactorView  *views.Views
+	TokensView          *views.Views
+	PrivacyView         *views.Views
+	PeopleView          *views.Views
 	us                  models.UserService
+	ls                  models.LoginService
+	prs                 models.PasswordResetService
+	evs                 models.EmailVerificationService
+	ss                  models.SessionService
+	tfs                 models.TwoFactorService
+	ats                 models.APITokenService
+	sks                 models.SkillService
+	vs                  models.VisibilityService
+	pfs                 models.ProfileService
+	srs                 models.SearchService
+	avs                 models.AvatarService
+	mailer              email.Mailer
+	cookies             *middleware.Cookies
+	baseURL             string
 }
 
 // UserForm defines the shape of the signup form
@@ -27,9 +59,10 @@ type UserForm struct {
 }
 
 type completeForm struct {
-	Title   string `schema:"title"`
-	Summary string `schema:"summary"`
-	Skills  string `schema:"skills"`
+	Username string `schema:"username"`
+	Title    string `schema:"title"`
+	Summary  string `schema:"summary"`
+	Skills   string `schema:"skills"`
 }
 
 type loginForm struct {
@@ -37,17 +70,65 @@ type loginForm struct {
 	Password string `schema:"password"`
 }
 
-// NewUser returns the user struct
-func NewUser(us models.UserService) *User {
+type forgotForm struct {
+	Email string `schema:"email"`
+}
+
+type resetForm struct {
+	Token    string `schema:"token"`
+	Password string `schema:"password"`
+}
+
+// profilePage defines the shape of the dashboard and public profile page data
+type profilePage struct {
+	*models.Profile
+	Levels []string
+	Themes []string
+}
+
+// NewUser returns the user struct, links in emails and on share pages are
+// built on baseURL
+func NewUser(services *models.Services, mailer email.Mailer, cookies *middleware.Cookies, baseURL string) *User {
 	return &User{
 		NewView:             views.NewView("bootstrap", "user/new"),
 		LoginView:           views.NewView("bootstrap", "user/login"),
 		CompleteProfileView: views.NewView("bootstrap", "user/profile"),
 		DashboardView:       views.NewView("bootstrap", "user/dashboard"),
-		us:                  us,
+		PublicView:          views.NewView("bootstrap", "user/public"),
+		ForgotView:          views.NewView("bootstrap", "user/forgot"),
+		ResetView:           views.NewView("bootstrap", "user/reset"),
+		VerifyView:          views.NewView("bootstrap", "user/verify"),
+		DevicesView:         views.NewView("bootstrap", "user/devices"),
+		TwoFactorView:       views.NewView("bootstrap", "user/twofactor"),
+		RecoveryCodesView:   views.NewView("bootstrap", "user/recovery"),
+		LoginTwoFactorView:  views.NewView("bootstrap", "user/login2fa"),
+		TokensView:          views.NewView("bootstrap", "user/tokens"),
+		PrivacyView:         views.NewView("bootstrap", "user/privacy"),
+		PeopleView:          views.NewView("bootstrap", "user/people"),
+		us:                  services.User,
+		ls:                  services.Login,
+		prs:                 services.PasswordReset,
+		evs:                 services.Verification,
+		ss:                  services.Session,
+		tfs:                 services.TwoFactor,
+		ats:                 services.APIToken,
+		sks:                 services.Skill,
+		vs:                  services.Visibility,
+		pfs:                 services.Profile,
+		srs:                 services.Search,
+		avs:                 services.Avatar,
+		mailer:              mailer,
+		cookies:             cookies,
+		baseURL:             baseURL,
 	}
 }
 
+// absoluteURL builds a full URL to path on the configured base URL. The
+// Host header comes from the client, so links must never be built from it
+func (u *User) absoluteURL(path string) string {
+	return u.baseURL + path
+}
+
 // New handles route /signup
 func (u *User) New(w http.ResponseWriter, r *http.Request) {
 	u.NewView.Render(w, r, nil)
@@ -64,14 +145,29 @@ func (u *User) Register(w http.ResponseWriter, r *http.Request) {
 		Password: form.Password,
 	}
 	if err := u.us.Create(&user); err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
 		data.SetAlert(views.ErrLevelDanger, err)
 		u.NewView.Render(w, r, data)
 		return
 	}
-	if err := u.signIn(w, &user); err != nil {
+	if err := u.signIn(w, r, &user); err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
 		u.NewView.Render(w, r, nil)
 		return
 	}
+	if err := u.sendVerification(r, &user); err != nil {
+		log.Println(err)
+	}
+	if views.WantsJSON(r) {
+		views.RenderJSON(w, http.StatusCreated, newUserResponse(&user))
+		return
+	}
 	uri := fmt.Sprintf("/complete-profile?email=%s", user.Email)
 	http.Redirect(w, r, uri, http.StatusFound)
 }
@@ -88,19 +184,35 @@ func (u *User) Profile(w http.ResponseWriter, r *http.Request) {
 	var data views.Data
 
 	ParseForm(r, &form)
-	// skills := strings.Split(form.Skills, ",")
 	user := context.GetUserFromContext(r.Context())
 
-	user.Skills = form.Skills
+	user.Username = form.Username
 	user.Summary = form.Summary
 	user.Title = form.Title
 
-	if err := u.us.Update(user); err != nil {
-		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+	err := u.us.Update(user)
+	if err == nil {
+		err = u.sks.SetUserSkills(user, models.SplitSkills(form.Skills))
+	}
+	if err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
+		if errorStatus(err) == http.StatusInternalServerError {
+			log.Println(err)
+			err = models.ErrInternalServerError
+		}
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = user.Email
 		u.CompleteProfileView.Render(w, r, data)
 		return
 	}
 
+	if views.WantsJSON(r) {
+		views.RenderJSON(w, http.StatusOK, newUserResponse(user))
+		return
+	}
 	http.Redirect(w, r, "/dashboard", http.StatusFound)
 }
 
@@ -115,46 +227,285 @@ func (u *User) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var data views.Data
 	ParseForm(r, &form)
 
-	user := &models.User{
-		Email:    form.Email,
-		Password: form.Password,
-	}
-	foundUser, err := u.us.Authenticate(user)
+	foundUser, err := u.authenticate(r, form.Email, form.Password)
 	if err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
 		data.SetAlert(views.ErrLevelDanger, err)
 		u.LoginView.Render(w, r, data)
 		return
 	}
-	if err := u.signIn(w, foundUser); err != nil {
+	if foundUser.TOTPEnabled {
+		u.startTwoFactorLogin(w, r, foundUser)
+		return
+	}
+	if err := u.signIn(w, r, foundUser); err != nil {
+		if views.WantsJSON(r) {
+			renderAPIError(w, err)
+			return
+		}
 		data.SetAlert(views.ErrLevelDanger, err)
 		u.LoginView.Render(w, r, data)
 		return
 	}
+	if views.WantsJSON(r) {
+		views.RenderJSON(w, http.StatusOK, newUserResponse(foundUser))
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// Forgot renders the forgot password view
+func (u *User) Forgot(w http.ResponseWriter, r *http.Request) {
+	u.ForgotView.Render(w, r, nil)
+}
+
+// HandleForgot issues a password reset token and emails the reset link.
+// The same message is shown whether or not the email exists so the form
+// cannot be used to discover accounts
+func (u *User) HandleForgot(w http.ResponseWriter, r *http.Request) {
+	var form forgotForm
+	var data views.Data
+	ParseForm(r, &form)
+
+	token, err := u.prs.Initiate(form.Email)
+	switch err {
+	case nil:
+		uri := u.absoluteURL("/reset?token=" + url.QueryEscape(token))
+		if err := email.ResetPassword(u.mailer, form.Email, uri, models.PasswordResetExpiry); err != nil {
+			log.Println(err)
+			data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+			u.ForgotView.Render(w, r, data)
+			return
+		}
+	case models.ErrNotFound:
+	default:
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		u.ForgotView.Render(w, r, data)
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "If that email has an account, a reset link is on its way")
+	u.ForgotView.Render(w, r, data)
+}
+
+// Reset renders the reset password view
+func (u *User) Reset(w http.ResponseWriter, r *http.Request) {
+	token := FromQuery(r, "token")
+	u.ResetView.Render(w, r, token)
+}
+
+// HandleReset sets the new password and signs the user in
+func (u *User) HandleReset(w http.ResponseWriter, r *http.Request) {
+	var form resetForm
+	var data views.Data
+	ParseForm(r, &form)
+
+	user, err := u.prs.Complete(form.Token, form.Password)
+	if err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		data.Yield = form.Token
+		u.ResetView.Render(w, r, data)
+		return
+	}
+	if err := u.ss.DeleteByUser(user.ID); err != nil {
+		log.Println(err)
+	}
+	if err := u.signIn(w, r, user); err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+// Verify confirms the email address when a token is present, otherwise
+// it renders the page asking the user to check their inbox
+func (u *User) Verify(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	token := FromQuery(r, "token")
+	if token == "" {
+		u.VerifyView.Render(w, r, nil)
+		return
+	}
+	if _, err := u.evs.Complete(token); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.VerifyView.Render(w, r, data)
+		return
+	}
 	http.Redirect(w, r, "/dashboard", http.StatusFound)
 }
 
+// Unlock handles the link emailed when an account was locked after too
+// many failed logins
+func (u *User) Unlock(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	if _, err := u.ls.Unlock(FromQuery(r, "token")); err != nil {
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.LoginView.Render(w, r, data)
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "Your account is unlocked, you can log in again")
+	u.LoginView.Render(w, r, data)
+}
+
+// ResendVerification emails a fresh confirmation link to the signed in user
+func (u *User) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	if err := u.sendVerification(r, user); err != nil {
+		if err != models.ErrAlreadyVerified {
+			log.Println(err)
+			err = models.ErrInternalServerError
+		}
+		data.SetAlert(views.ErrLevelDanger, err)
+		u.VerifyView.Render(w, r, data)
+		return
+	}
+	data.SetAlertMessage(views.LevelSuccess, "A new confirmation link has been sent to "+user.Email)
+	u.VerifyView.Render(w, r, data)
+}
+
 // Dashboard renders the dashboard page
 func (u *User) Dashboard(w http.ResponseWriter, r *http.Request) {
+	var data views.Data
+	user := context.GetUserFromContext(r.Context())
+	if views.WantsJSON(r) {
+		views.RenderJSON(w, http.StatusOK, newUserResponse(user))
+		return
+	}
+	u.renderDashboard(w, r, data)
+}
+
+// renderDashboard loads every profile section of the signed in user and
+// renders the dashboard with them
+func (u *User) renderDashboard(w http.ResponseWriter, r *http.Request, data views.Data) {
 	user := context.GetUserFromContext(r.Context())
-	u.DashboardView.Render(w, r, user)
+	u.renderProfile(w, r, u.DashboardView, data, user, models.Viewer{User: user})
+}
+
+// dashboardError shows err on the dashboard, where the profile forms live
+func (u *User) dashboardError(w http.ResponseWriter, r *http.Request, err error) {
+	var data views.Data
+	if errorStatus(err) == http.StatusInternalServerError {
+		log.Println(err)
+		err = models.ErrInternalServerError
+	}
+	data.SetAlert(views.ErrLevelDanger, err)
+	u.renderDashboard(w, r, data)
 }
 
-// Users gets all users
+// Public renders the public profile at /u/{username}. Old usernames
+// redirect to the current one
+func (u *User) Public(w http.ResponseWriter, r *http.Request) {
+	user := u.publicUser(w, r, "")
+	if user == nil {
+		return
+	}
+	var data views.Data
+	u.renderProfile(w, r, u.PublicView, data, user, viewerFromRequest(r))
+}
+
+// publicUser looks up the owner of the profile at /u/{username}. When
+// the username is not the current one it redirects to the current URL,
+// with suffix after the username, and returns nil
+func (u *User) publicUser(w http.ResponseWriter, r *http.Request, suffix string) *models.User {
+	username := mux.Vars(r)["username"]
+	user, err := u.us.ByUsername(username)
+	if err != nil {
+		if id, err := u.us.UsernameRedirect(username); err == nil {
+			if user, err := u.us.ByID(id); err == nil && user.Username != "" {
+				redirectToProfile(w, r, user, suffix)
+				return nil
+			}
+		}
+		http.NotFound(w, r)
+		return nil
+	}
+	if user.Username != username {
+		redirectToProfile(w, r, user, suffix)
+		return nil
+	}
+	return user
+}
+
+// renderProfile renders the profile of owner as viewer is allowed to see it
+func (u *User) renderProfile(w http.ResponseWriter, r *http.Request, view *views.Views, data views.Data,
+	owner *models.User, viewer models.Viewer) {
+	profile, err := u.pfs.View(owner, viewer)
+	if err != nil {
+		log.Println(err)
+		data.SetAlert(views.ErrLevelDanger, models.ErrInternalServerError)
+		profile = &models.Profile{User: &models.User{Name: owner.Name, Username: owner.Username}}
+		if viewer.User != nil && viewer.User.ID == owner.ID {
+			profile.User = owner
+		}
+	}
+	data.Yield = profilePage{
+		Profile: profile,
+		Levels:  models.SkillLevels,
+		Themes:  export.PDFThemeNames(),
+	}
+	view.Render(w, r, data)
+}
+
+// viewerFromRequest describes who is looking at a profile, the signed in
+// user if any and the share token from the link they followed
+func viewerFromRequest(r *http.Request) models.Viewer {
+	return models.Viewer{
+		User:       context.GetUserFromContext(r.Context()),
+		ShareToken: r.URL.Query().Get("share"),
+	}
+}
+
+// redirectToProfile sends the client to the current profile URL of user,
+// keeping the query so share links survive a rename
+func redirectToProfile(w http.ResponseWriter, r *http.Request, user *models.User, suffix string) {
+	uri := "/u/" + user.Username + suffix
+	if r.URL.RawQuery != "" {
+		uri += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, uri, http.StatusMovedPermanently)
+}
+
+// Users lists the public profile of every user as JSON
 func (u *User) Users(w http.ResponseWriter, r *http.Request) {
-	users, err := u.us.All()
-	// user, err := u.us.ByEmail("chibuzor.ojukwu@gmail.com")
+	u.APIUsers(w, r)
+}
+
+func (u *User) sendVerification(r *http.Request, user *models.User) error {
+	token, err := u.evs.Initiate(user)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fmt.Fprintf(w, "%+v\n", users)
+	uri := u.absoluteURL("/verify?token=" + url.QueryEscape(token))
+	return email.VerifyEmail(u.mailer, user.Name, user.Email, uri, models.EmailVerificationExpiry)
 }
 
-func (u *User) signIn(w http.ResponseWriter, user *models.User) error {
-	cookie := &http.Cookie{
-		Name:     "remember_token",
-		Value:    user.Remember,
-		HttpOnly: true,
+// authenticate checks the credentials through the login throttle, and
+// emails the unlock link when this attempt locked the account
+func (u *User) authenticate(r *http.Request, address, password string) (*models.User, error) {
+	user, err := u.ls.Authenticate(&models.User{
+		Email:    address,
+		Password: password,
+	}, ClientIP(r))
+	if lockout, ok := err.(*models.Lockout); ok {
+		uri := u.absoluteURL("/unlock?token=" + url.QueryEscape(lockout.Token))
+		err := email.UnlockAccount(u.mailer, lockout.User.Name, lockout.User.Email, uri, models.AccountUnlockExpiry)
+		if err != nil {
+			log.Println(err)
+		}
+		return nil, models.ErrTooManyAttempts
+	}
+	return user, err
+}
+
+// signIn starts a new session for the user on this device
+func (u *User) signIn(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	session, err := u.ss.Start(user, r.UserAgent(), ClientIP(r))
+	if err != nil {
+		return err
 	}
-	http.SetCookie(w, cookie)
+	u.cookies.SetSession(w, session.Token, session.ExpiresAt)
 	return nil
 }
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"profile.com/config"
+	"profile.com/context"
+	"profile.com/email"
+	"profile.com/middleware"
+	"profile.com/models"
+)
+
+const testBaseURL = "https://profile.example.com"
+
+// TestMain runs the tests from the repository root, where the views are
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeUserService keeps users in memory. Methods the tests do not use are
+// left to the nil embedded interface
+type fakeUserService struct {
+	models.UserService
+	users []*models.User
+}
+
+func (us *fakeUserService) Create(user *models.User) error {
+	if user.Name == "" {
+		return models.ErrNameMissing
+	}
+	if user.Email == "" {
+		return models.ErrEmailMissing
+	}
+	for _, u := range us.users {
+		if u.Email == user.Email {
+			return models.ErrEmailTaken
+		}
+	}
+	user.ID = uint(len(us.users) + 1)
+	user.Password = ""
+	us.users = append(us.users, user)
+	return nil
+}
+
+// Update only checks the username is free, like the real service does
+// before saving
+func (us *fakeUserService) Update(user *models.User) error {
+	for _, u := range us.users {
+		if u.ID != user.ID && user.Username != "" && strings.EqualFold(u.Username, user.Username) {
+			return models.ErrUsernameTaken
+		}
+	}
+	return nil
+}
+
+type fakeSessionService struct {
+	models.SessionService
+}
+
+func (ss *fakeSessionService) Start(user *models.User, userAgent, ip string) (*models.Session, error) {
+	return &models.Session{
+		UserID:    user.ID,
+		Token:     fmt.Sprintf("session-%d", user.ID),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, nil
+}
+
+// fakeVerificationService hands out numbered single use tokens, like the
+// real service a new token replaces the user's earlier ones
+type fakeVerificationService struct {
+	tokens map[string]*models.User
+	issued int
+}
+
+func (evs *fakeVerificationService) Initiate(user *models.User) (string, error) {
+	if user.Verified {
+		return "", models.ErrAlreadyVerified
+	}
+	for token, u := range evs.tokens {
+		if u.ID == user.ID {
+			delete(evs.tokens, token)
+		}
+	}
+	evs.issued++
+	token := fmt.Sprintf("verify-%d", evs.issued)
+	evs.tokens[token] = user
+	return token, nil
+}
+
+func (evs *fakeVerificationService) Complete(token string) (*models.User, error) {
+	user, ok := evs.tokens[token]
+	if !ok {
+		return nil, models.ErrTokenInvalid
+	}
+	delete(evs.tokens, token)
+	user.Verified = true
+	return user, nil
+}
+
+type userTest struct {
+	c      *User
+	outbox *email.Outbox
+	us     *fakeUserService
+}
+
+func newUserTest(t *testing.T) *userTest {
+	t.Helper()
+	outbox := email.NewOutbox()
+	us := &fakeUserService{}
+	services := &models.Services{
+		User:         us,
+		Session:      &fakeSessionService{},
+		Verification: &fakeVerificationService{tokens: map[string]*models.User{}},
+	}
+	cookies := middleware.NewCookies(config.CookieConfig{})
+	return &userTest{
+		c:      NewUser(services, outbox, cookies, testBaseURL),
+		outbox: outbox,
+		us:     us,
+	}
+}
+
+func postForm(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func withUser(r *http.Request, user *models.User) *http.Request {
+	return r.WithContext(context.SetUserInContext(r.Context(), user))
+}
+
+var verifyLink = regexp.MustCompile(regexp.QuoteMeta(testBaseURL) + `/verify\?token=(\S+)`)
+
+// verifyToken returns the token of the confirmation link in msg
+func verifyToken(t *testing.T, msg email.Message) string {
+	t.Helper()
+	if msg.Subject != "Confirm your email address" {
+		t.Errorf("Subject = %q, want the confirmation email", msg.Subject)
+	}
+	m := verifyLink.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no confirmation link on %s in body:\n%s", testBaseURL, msg.Body)
+	}
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRegisterSendsVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		form     url.Values
+		wantCode int
+		wantSent bool
+	}{
+		{
+			name:     "new user",
+			form:     url.Values{"name": {"Ada"}, "email": {"ada@example.com"}, "password": {"correct horse"}},
+			wantCode: http.StatusFound,
+			wantSent: true,
+		},
+		{
+			name:     "missing name",
+			form:     url.Values{"email": {"ada@example.com"}, "password": {"correct horse"}},
+			wantCode: http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ut := newUserTest(t)
+			w := httptest.NewRecorder()
+			ut.c.Register(w, postForm("/signup", tc.form))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			msgs := ut.outbox.Messages()
+			if !tc.wantSent {
+				if len(msgs) != 0 {
+					t.Errorf("sent %d emails, want none", len(msgs))
+				}
+				return
+			}
+			if len(msgs) != 1 {
+				t.Fatalf("sent %d emails, want 1", len(msgs))
+			}
+			if msgs[0].To != tc.form.Get("email") {
+				t.Errorf("To = %q, want %q", msgs[0].To, tc.form.Get("email"))
+			}
+			verifyToken(t, msgs[0])
+		})
+	}
+}
+
+func TestVerifyWithEmailedLink(t *testing.T) {
+	ut := newUserTest(t)
+	form := url.Values{"name": {"Ada"}, "email": {"ada@example.com"}, "password": {"correct horse"}}
+	ut.c.Register(httptest.NewRecorder(), postForm("/signup", form))
+	msg, ok := ut.outbox.Last()
+	if !ok {
+		t.Fatal("no confirmation email sent")
+	}
+	token := verifyToken(t, msg)
+
+	w := httptest.NewRecorder()
+	ut.c.Verify(w, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/dashboard" {
+		t.Errorf("got %d to %q, want a redirect to /dashboard", w.Code, w.Header().Get("Location"))
+	}
+	if !ut.us.users[0].Verified {
+		t.Error("user is not verified")
+	}
+
+	// the link only works once
+	w = httptest.NewRecorder()
+	ut.c.Verify(w, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "This link is invalid or has expired") {
+		t.Errorf("reused link: got %d, want the page with an invalid token alert", w.Code)
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified bool
+		wantSent bool
+		wantText string
+	}{
+		{
+			name:     "unverified",
+			wantSent: true,
+			wantText: "A new confirmation link has been sent to ada@example.com",
+		},
+		{
+			name:     "already verified",
+			verified: true,
+			wantText: "Your email is already verified",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ut := newUserTest(t)
+			form := url.Values{"name": {"Ada"}, "email": {"ada@example.com"}, "password": {"correct horse"}}
+			ut.c.Register(httptest.NewRecorder(), postForm("/signup", form))
+			first, _ := ut.outbox.Last()
+			user := ut.us.users[0]
+			user.Verified = tc.verified
+			ut.outbox.Reset()
+
+			w := httptest.NewRecorder()
+			ut.c.ResendVerification(w, withUser(postForm("/verify", nil), user))
+			if !strings.Contains(w.Body.String(), tc.wantText) {
+				t.Errorf("page does not say %q", tc.wantText)
+			}
+			msgs := ut.outbox.Messages()
+			if !tc.wantSent {
+				if len(msgs) != 0 {
+					t.Errorf("sent %d emails, want none", len(msgs))
+				}
+				return
+			}
+			if len(msgs) != 1 || msgs[0].To != "ada@example.com" {
+				t.Fatalf("sent %v, want one email to ada@example.com", msgs)
+			}
+			token := verifyToken(t, msgs[0])
+			if token == verifyToken(t, first) {
+				t.Error("resent link reuses the first token")
+			}
+
+			// the new link works and replaced the first one
+			w = httptest.NewRecorder()
+			ut.c.Verify(w, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(verifyToken(t, first)), nil))
+			if w.Code == http.StatusFound {
+				t.Error("first link still verifies after a resend")
+			}
+			w = httptest.NewRecorder()
+			ut.c.Verify(w, httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil))
+			if w.Code != http.StatusFound || !user.Verified {
+				t.Errorf("resent link: got %d, verified %v", w.Code, user.Verified)
+			}
+		})
+	}
+}
+
+func TestProfileUsernameTaken(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		wantCode int
+	}{
+		{"page", "text/html", http.StatusOK},
+		{"json", "application/json", http.StatusConflict},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ut := newUserTest(t)
+			ut.us.users = []*models.User{{Name: "Ada", Email: "ada@example.com", Username: "ada"}}
+			ut.us.users[0].ID = 1
+			grace := &models.User{Name: "Grace", Email: "grace@example.com"}
+			grace.ID = 2
+
+			r := postForm("/complete-profile", url.Values{"username": {"ADA"}, "title": {"Engineer"}})
+			r.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+			ut.c.Profile(w, withUser(r, grace))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if body := w.Body.String(); !strings.Contains(body, "This username is not available") {
+				t.Errorf("body does not say the username is taken:\n%s", body)
+			}
+		})
+	}
+}
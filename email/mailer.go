@@ -0,0 +1,116 @@
+package email
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	resetSubject = "Reset your password"
+	resetBody    = `Hi,
+
+Someone requested a password reset for your account. If this was you,
+follow the link below to choose a new password:
+
+%s
+
+The link expires in %s and can only be used once. If you did not
+request a reset you can safely ignore this email.
+`
+	verifySubject = "Confirm your email address"
+	verifyBody    = `Hi %s,
+
+Thanks for signing up! Please confirm your email address by following
+the link below:
+
+%s
+
+The link expires in %s.
+`
+	unlockSubject = "Your account has been locked"
+	unlockBody    = `Hi %s,
+
+There were too many failed attempts to log in to your account, so we
+have locked it for a while. If this was you, follow the link below to
+unlock it right away:
+
+%s
+
+The link expires in %s. If it was not you, someone may be guessing your
+password and you should reset it.
+`
+)
+
+// Message defines the shape of an outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by anything that can deliver an email
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes every email to an io.Writer instead of delivering it,
+// so the app works without an SMTP server
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogMailer returns a mailer that writes emails to w
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{
+		w: w,
+	}
+}
+
+// NewFileMailer returns a mailer that appends emails to the file at path
+func NewFileMailer(path string) (*LogMailer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogMailer(f), nil
+}
+
+// Send writes the message to the underlying writer
+func (lm *LogMailer) Send(msg Message) error {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	_, err := fmt.Fprintf(lm.w, "----- %s -----\nTo: %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+// ResetPassword sends the password reset link to the user
+func ResetPassword(m Mailer, to, resetURL string, expiry time.Duration) error {
+	return m.Send(Message{
+		To:      to,
+		Subject: resetSubject,
+		Body:    fmt.Sprintf(resetBody, resetURL, expiry),
+	})
+}
+
+// VerifyEmail sends the email confirmation link to a new user
+func VerifyEmail(m Mailer, name, to, verifyURL string, expiry time.Duration) error {
+	return m.Send(Message{
+		To:      to,
+		Subject: verifySubject,
+		Body:    fmt.Sprintf(verifyBody, name, verifyURL, expiry),
+	})
+}
+
+// UnlockAccount sends the link that lifts a login lockout
+func UnlockAccount(m Mailer, name, to, unlockURL string, expiry time.Duration) error {
+	return m.Send(Message{
+		To:      to,
+		Subject: unlockSubject,
+		Body:    fmt.Sprintf(unlockBody, name, unlockURL, expiry),
+	})
+}
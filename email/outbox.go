@@ -0,0 +1,49 @@
+package email
+
+import "sync"
+
+// Outbox keeps every sent email in memory, useful for tests and local
+// development where nothing should leave the process
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox returns an empty in-memory outbox
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// Send appends the message to the outbox
+func (o *Outbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msgs := make([]Message, len(o.messages))
+	copy(msgs, o.messages)
+	return msgs
+}
+
+// Last returns the most recently sent message, or false if there is none
+func (o *Outbox) Last() (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == 0 {
+		return Message{}, false
+	}
+	return o.messages[len(o.messages)-1], true
+}
+
+// Reset empties the outbox
+func (o *Outbox) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = nil
+}
@@ -0,0 +1,246 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"profile.com/models"
+)
+
+// JSONResumeSchema is the schema exported resumes point at
+const JSONResumeSchema = "https://raw.githubusercontent.com/jsonresume/resume-schema/v1.0.0/schema.json"
+
+// resumeDateFormat is the precision profile dates are kept at
+const resumeDateFormat = "2006-01"
+
+// ErrResumeInvalid is returned when a JSON Resume document cannot be read
+var ErrResumeInvalid = errors.New("export: JSON Resume document is invalid")
+
+// Resume is a JSON Resume document, see https://jsonresume.org/schema
+type Resume struct {
+	Schema    string            `json:"$schema,omitempty"`
+	Basics    ResumeBasics      `json:"basics"`
+	Work      []ResumeWork      `json:"work,omitempty"`
+	Education []ResumeEducation `json:"education,omitempty"`
+	Projects  []ResumeProject   `json:"projects,omitempty"`
+	Skills    []ResumeSkill     `json:"skills,omitempty"`
+}
+
+// ResumeBasics holds who the resume is about
+type ResumeBasics struct {
+	Name    string `json:"name"`
+	Label   string `json:"label,omitempty"`
+	Email   string `json:"email,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// ResumeWork is one position held. Company is read from older documents
+// that used it in place of Name
+type ResumeWork struct {
+	Name      string `json:"name"`
+	Company   string `json:"company,omitempty"`
+	Position  string `json:"position"`
+	StartDate string `json:"startDate,omitempty"`
+	EndDate   string `json:"endDate,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+}
+
+// ResumeEducation is one course of study
+type ResumeEducation struct {
+	Institution string `json:"institution"`
+	Area        string `json:"area,omitempty"`
+	StudyType   string `json:"studyType,omitempty"`
+	StartDate   string `json:"startDate,omitempty"`
+	EndDate     string `json:"endDate,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+}
+
+// ResumeProject is one portfolio project
+type ResumeProject struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+}
+
+// ResumeSkill is one skill and how well it is known
+type ResumeSkill struct {
+	Name     string   `json:"name"`
+	Level    string   `json:"level,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
+}
+
+// JSONResume maps a profile to a JSON Resume document. The profile should
+// come from models.ProfileService.View so hidden fields are already left
+// out. url is the public address of the profile, if it has one
+func JSONResume(profile *models.Profile, url string) *Resume {
+	user := profile.User
+	resume := &Resume{
+		Schema: JSONResumeSchema,
+		Basics: ResumeBasics{
+			Name:    user.Name,
+			Label:   user.Title,
+			Email:   user.Email,
+			URL:     url,
+			Summary: user.Summary,
+		},
+	}
+	for _, e := range profile.Experience {
+		resume.Work = append(resume.Work, ResumeWork{
+			Name:      e.Company,
+			Position:  e.Role,
+			StartDate: formatResumeDate(&e.StartDate),
+			EndDate:   formatResumeDate(e.EndDate),
+			Summary:   e.Description,
+		})
+	}
+	for _, e := range profile.Education {
+		resume.Education = append(resume.Education, ResumeEducation{
+			Institution: e.School,
+			Area:        e.Field,
+			StudyType:   e.Degree,
+			StartDate:   formatResumeDate(&e.StartDate),
+			EndDate:     formatResumeDate(e.EndDate),
+			Summary:     e.Description,
+		})
+	}
+	for _, p := range profile.Projects {
+		resume.Projects = append(resume.Projects, ResumeProject{
+			Name:        p.Name,
+			Description: p.Description,
+			URL:         p.URL,
+			Keywords:    p.TechList(),
+		})
+	}
+	for _, s := range profile.Skills {
+		skill := ResumeSkill{Name: s.Skill.Name}
+		if s.Level > 0 {
+			skill.Level = s.LevelName()
+		}
+		resume.Skills = append(resume.Skills, skill)
+	}
+	return resume
+}
+
+// ParseJSONResume reads a JSON Resume document
+func ParseJSONResume(r io.Reader) (*Resume, error) {
+	var resume Resume
+	if err := json.NewDecoder(r).Decode(&resume); err != nil {
+		return nil, ErrResumeInvalid
+	}
+	return &resume, nil
+}
+
+// Profile maps the resume back to a profile that can be imported with
+// models.ProfileService.Import. Entries without a start date are skipped
+// since profile sections need one
+func (resume *Resume) Profile() (*models.Profile, error) {
+	profile := &models.Profile{
+		User: &models.User{
+			Name:    resume.Basics.Name,
+			Title:   resume.Basics.Label,
+			Summary: resume.Basics.Summary,
+		},
+	}
+	for _, w := range resume.Work {
+		start, end, err := parseResumeDates(w.StartDate, w.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		if start == nil {
+			continue
+		}
+		company := w.Name
+		if company == "" {
+			company = w.Company
+		}
+		profile.Experience = append(profile.Experience, models.Experience{
+			Company:     company,
+			Role:        w.Position,
+			StartDate:   *start,
+			EndDate:     end,
+			Description: w.Summary,
+		})
+	}
+	for _, e := range resume.Education {
+		start, end, err := parseResumeDates(e.StartDate, e.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		if start == nil {
+			continue
+		}
+		profile.Education = append(profile.Education, models.Education{
+			School:      e.Institution,
+			Degree:      e.StudyType,
+			Field:       e.Area,
+			StartDate:   *start,
+			EndDate:     end,
+			Description: e.Summary,
+		})
+	}
+	for _, p := range resume.Projects {
+		profile.Projects = append(profile.Projects, models.Project{
+			Name:        p.Name,
+			URL:         p.URL,
+			Description: p.Description,
+			Tech:        strings.Join(p.Keywords, ", "),
+		})
+	}
+	for _, s := range resume.Skills {
+		profile.Skills = append(profile.Skills, models.UserSkill{
+			Skill: models.Skill{Name: s.Name},
+			Level: resumeSkillLevel(s.Level),
+		})
+	}
+	return profile, nil
+}
+
+func formatResumeDate(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(resumeDateFormat)
+}
+
+// parseResumeDates reads the start and end of an entry, JSON Resume
+// allows a year, a month or a full date
+func parseResumeDates(start, end string) (*time.Time, *time.Time, error) {
+	s, err := parseResumeDate(start)
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := parseResumeDate(end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, e, nil
+}
+
+func parseResumeDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", resumeDateFormat, "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, models.ErrDateInvalid
+}
+
+// resumeSkillLevel maps a free text level to the closest proficiency
+// level, or zero when it is not one we know
+func resumeSkillLevel(level string) int {
+	for i, name := range models.SkillLevels {
+		if i > 0 && strings.EqualFold(strings.TrimSpace(level), name) {
+			return i
+		}
+	}
+	return 0
+}
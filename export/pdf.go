@@ -0,0 +1,287 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"profile.com/models"
+)
+
+// PDFTheme decides the look of a PDF resume
+type PDFTheme struct {
+	Name     string
+	Font     string
+	FontSize float64
+	Accent   [3]int
+	Text     [3]int
+	Muted    [3]int
+	// Rule draws a line under every section heading
+	Rule bool
+}
+
+// DefaultPDFTheme is used when no theme, or an unknown one, is asked for
+const DefaultPDFTheme = "modern"
+
+// PDFThemes lists the themes a resume can be rendered with
+var PDFThemes = map[string]PDFTheme{
+	"modern": {
+		Name:     "modern",
+		Font:     "Helvetica",
+		FontSize: 10,
+		Accent:   [3]int{86, 61, 124},
+		Text:     [3]int{33, 37, 41},
+		Muted:    [3]int{108, 117, 125},
+		Rule:     true,
+	},
+	"classic": {
+		Name:     "classic",
+		Font:     "Times",
+		FontSize: 11,
+		Accent:   [3]int{0, 0, 0},
+		Text:     [3]int{0, 0, 0},
+		Muted:    [3]int{80, 80, 80},
+		Rule:     true,
+	},
+	"compact": {
+		Name:     "compact",
+		Font:     "Helvetica",
+		FontSize: 8.5,
+		Accent:   [3]int{0, 86, 179},
+		Text:     [3]int{33, 37, 41},
+		Muted:    [3]int{108, 117, 125},
+	},
+}
+
+// PDFThemeNames returns the name of every theme, the default first
+func PDFThemeNames() []string {
+	names := []string{DefaultPDFTheme}
+	for name := range PDFThemes {
+		if name != DefaultPDFTheme {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// PDFThemeByName returns the theme called name, or the default theme
+func PDFThemeByName(name string) PDFTheme {
+	if theme, ok := PDFThemes[name]; ok {
+		return theme
+	}
+	return PDFThemes[DefaultPDFTheme]
+}
+
+const (
+	pdfMargin     = 18.0
+	pdfDateWidth  = 45.0
+	pdfDateLayout = "Jan 2006"
+)
+
+// pdfResume lays out one resume
+type pdfResume struct {
+	pdf   *fpdf.Fpdf
+	theme PDFTheme
+	tr    func(string) string
+	width float64
+	line  float64
+}
+
+// PDF writes the profile to w as an A4 resume, flowing onto as many pages
+// as it needs. Like JSONResume the profile should come from
+// models.ProfileService.View, url is the public address of the profile
+func PDF(w io.Writer, profile *models.Profile, url string, theme PDFTheme) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.AliasNbPages("")
+	pdf.SetTitle(profile.User.Name, true)
+	pdf.SetAuthor(profile.User.Name, true)
+	pdf.SetCreator("profile.com", true)
+
+	pageWidth, _ := pdf.GetPageSize()
+	r := &pdfResume{
+		pdf:   pdf,
+		theme: theme,
+		tr:    pdf.UnicodeTranslatorFromDescriptor(""),
+		width: pageWidth - 2*pdfMargin,
+		line:  theme.FontSize * 0.5,
+	}
+	pdf.SetFooterFunc(r.footer)
+	pdf.AddPage()
+
+	r.header(profile.User, url)
+	r.summary(profile.User.Summary)
+	r.experience(profile.Experience)
+	r.education(profile.Education)
+	r.projects(profile.Projects)
+	r.skills(profile.Skills)
+	return pdf.Output(w)
+}
+
+func (r *pdfResume) color(c [3]int) {
+	r.pdf.SetTextColor(c[0], c[1], c[2])
+}
+
+func (r *pdfResume) font(style string, scale float64) {
+	r.pdf.SetFont(r.theme.Font, style, r.theme.FontSize*scale)
+}
+
+func (r *pdfResume) header(user *models.User, url string) {
+	r.font("B", 2.2)
+	r.color(r.theme.Accent)
+	r.pdf.CellFormat(r.width, r.line*2.4, r.tr(user.Name), "", 1, "L", false, 0, "")
+	if user.Title != "" {
+		r.font("", 1.3)
+		r.color(r.theme.Text)
+		r.pdf.CellFormat(r.width, r.line*1.6, r.tr(user.Title), "", 1, "L", false, 0, "")
+	}
+	var contact []string
+	if user.Email != "" {
+		contact = append(contact, user.Email)
+	}
+	if url != "" {
+		contact = append(contact, url)
+	}
+	if len(contact) > 0 {
+		r.font("", 1)
+		r.color(r.theme.Muted)
+		r.pdf.CellFormat(r.width, r.line*1.4, r.tr(strings.Join(contact, "  |  ")), "", 1, "L", false, 0, url)
+	}
+	r.pdf.Ln(r.line)
+}
+
+func (r *pdfResume) heading(title string) {
+	r.pdf.Ln(r.line * 0.6)
+	r.font("B", 1.25)
+	r.color(r.theme.Accent)
+	r.pdf.CellFormat(r.width, r.line*1.6, r.tr(strings.ToUpper(title)), "", 1, "L", false, 0, "")
+	if r.theme.Rule {
+		a := r.theme.Accent
+		r.pdf.SetDrawColor(a[0], a[1], a[2])
+		r.pdf.SetLineWidth(0.3)
+		y := r.pdf.GetY()
+		r.pdf.Line(pdfMargin, y, pdfMargin+r.width, y)
+		r.pdf.Ln(r.line * 0.6)
+	}
+}
+
+// entry writes the title of an entry with its dates on the right
+func (r *pdfResume) entry(title, subtitle, dates string) {
+	r.font("B", 1.05)
+	r.color(r.theme.Text)
+	r.pdf.CellFormat(r.width-pdfDateWidth, r.line*1.4, r.tr(title), "", 0, "L", false, 0, "")
+	r.font("", 0.95)
+	r.color(r.theme.Muted)
+	r.pdf.CellFormat(pdfDateWidth, r.line*1.4, r.tr(dates), "", 1, "R", false, 0, "")
+	if subtitle != "" {
+		r.font("I", 1)
+		r.color(r.theme.Text)
+		r.pdf.MultiCell(r.width, r.line*1.3, r.tr(subtitle), "", "L", false)
+	}
+}
+
+func (r *pdfResume) paragraph(text string) {
+	if text == "" {
+		return
+	}
+	r.font("", 1)
+	r.color(r.theme.Text)
+	r.pdf.MultiCell(r.width, r.line*1.3, r.tr(text), "", "L", false)
+}
+
+func (r *pdfResume) summary(summary string) {
+	if summary == "" {
+		return
+	}
+	r.heading("Summary")
+	r.paragraph(summary)
+}
+
+func (r *pdfResume) experience(list []models.Experience) {
+	if len(list) == 0 {
+		return
+	}
+	r.heading("Experience")
+	for _, e := range list {
+		r.entry(e.Role, e.Company, pdfDates(&e.StartDate, e.EndDate))
+		r.paragraph(e.Description)
+		r.pdf.Ln(r.line * 0.6)
+	}
+}
+
+func (r *pdfResume) education(list []models.Education) {
+	if len(list) == 0 {
+		return
+	}
+	r.heading("Education")
+	for _, e := range list {
+		var study []string
+		for _, s := range []string{e.Degree, e.Field} {
+			if s != "" {
+				study = append(study, s)
+			}
+		}
+		r.entry(e.School, strings.Join(study, ", "), pdfDates(&e.StartDate, e.EndDate))
+		r.paragraph(e.Description)
+		r.pdf.Ln(r.line * 0.6)
+	}
+}
+
+func (r *pdfResume) projects(list []models.Project) {
+	if len(list) == 0 {
+		return
+	}
+	r.heading("Projects")
+	for _, p := range list {
+		r.entry(p.Name, p.Tech, "")
+		if p.URL != "" {
+			r.font("", 0.95)
+			r.color(r.theme.Accent)
+			r.pdf.CellFormat(r.width, r.line*1.3, r.tr(p.URL), "", 1, "L", false, 0, p.URL)
+		}
+		r.paragraph(p.Description)
+		r.pdf.Ln(r.line * 0.6)
+	}
+}
+
+func (r *pdfResume) skills(list []models.UserSkill) {
+	if len(list) == 0 {
+		return
+	}
+	r.heading("Skills")
+	names := make([]string, 0, len(list))
+	for _, s := range list {
+		name := s.Skill.Name
+		if s.Level > 0 {
+			name += " (" + s.LevelName() + ")"
+		}
+		names = append(names, name)
+	}
+	r.paragraph(strings.Join(names, ", "))
+}
+
+func (r *pdfResume) footer() {
+	r.pdf.SetY(-pdfMargin + 4)
+	r.font("", 0.8)
+	r.color(r.theme.Muted)
+	page := fmt.Sprintf("%d / {nb}", r.pdf.PageNo())
+	r.pdf.CellFormat(r.width, r.line, page, "", 0, "C", false, 0, "")
+}
+
+// pdfDates formats the span of an entry, an open end meaning it is current
+func pdfDates(start, end *time.Time) string {
+	if start == nil || start.IsZero() {
+		return ""
+	}
+	to := "Present"
+	if end != nil && !end.IsZero() {
+		to = end.Format(pdfDateLayout)
+	}
+	return start.Format(pdfDateLayout) + " – " + to
+}
@@ -0,0 +1,235 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"profile.com/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestPDF(t *testing.T) {
+	type testCase struct {
+		name    string
+		theme   string
+		profile *models.Profile
+		pages   int
+	}
+	var tests []testCase
+	for _, name := range PDFThemeNames() {
+		tests = append(tests, testCase{
+			name:    "theme_" + name,
+			theme:   name,
+			profile: testProfile(2),
+			pages:   1,
+		})
+	}
+	tests = append(tests, testCase{
+		name:    "multipage",
+		theme:   DefaultPDFTheme,
+		profile: testProfile(25),
+		pages:   3,
+	})
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := PDF(&buf, tc.profile, "https://profile.com/u/ada", PDFThemeByName(tc.theme))
+			if err != nil {
+				t.Fatalf("PDF() error = %v", err)
+			}
+			pages, err := pdfText(buf.Bytes())
+			if err != nil {
+				t.Fatalf("extracting text: %v", err)
+			}
+			if len(pages) != tc.pages {
+				t.Errorf("got %d pages, want %d", len(pages), tc.pages)
+			}
+
+			var got strings.Builder
+			for i, page := range pages {
+				fmt.Fprintf(&got, "--- page %d ---\n", i+1)
+				for _, line := range page {
+					got.WriteString(line + "\n")
+				}
+			}
+			golden := filepath.Join("testdata", "pdf_"+tc.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file, run with -update to create it: %v", err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("text of %s does not match %s\ngot:\n%s\nwant:\n%s", tc.name, golden, got.String(), want)
+			}
+		})
+	}
+}
+
+func TestPDFThemeByName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"modern", "modern"},
+		{"classic", "classic"},
+		{"compact", "compact"},
+		{"", DefaultPDFTheme},
+		{"unknown", DefaultPDFTheme},
+	}
+	for _, tc := range tests {
+		if got := PDFThemeByName(tc.name).Name; got != tc.want {
+			t.Errorf("PDFThemeByName(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// testProfile returns a profile with every section filled in and the given
+// number of jobs, enough of them push the resume onto more pages
+func testProfile(jobs int) *models.Profile {
+	date := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	graduated := date(2012, time.June)
+	profile := &models.Profile{
+		User: &models.User{
+			Name:    "Ada Lovelace",
+			Email:   "ada@example.com",
+			Title:   "Analyst & Engineer",
+			Summary: "Writes programs for engines that do not exist yet, and the notes explaining why they will work.",
+		},
+		Education: []models.Education{{
+			School:    "University of London",
+			Degree:    "BSc",
+			Field:     "Mathematics",
+			StartDate: date(2009, time.September),
+			EndDate:   &graduated,
+		}},
+		Projects: []models.Project{{
+			Name:        "Bernoulli Numbers",
+			URL:         "https://example.com/notes",
+			Tech:        "Analytical Engine",
+			Description: "Note G, the first published program.",
+		}},
+		Skills: []models.UserSkill{
+			{Skill: models.Skill{Name: "Go"}, Level: 3},
+			{Skill: models.Skill{Name: "Mathematics"}},
+		},
+	}
+	for i := 0; i < jobs; i++ {
+		start := date(2020-i, time.March)
+		var end *time.Time
+		if i > 0 {
+			e := date(2021-i, time.February)
+			end = &e
+		}
+		profile.Experience = append(profile.Experience, models.Experience{
+			Company:     fmt.Sprintf("Company %d", i+1),
+			Role:        "Engineer",
+			StartDate:   start,
+			EndDate:     end,
+			Description: "Built and ran the systems the rest of the team relied on, and wrote down how they worked so others could too.",
+		})
+	}
+	return profile
+}
+
+// pdfText returns the text drawn on each page of a PDF written by fpdf, one
+// entry per text operator. fpdf writes one content stream per page, in
+// page order, and the core fonts use Windows-1252
+func pdfText(b []byte) ([][]string, error) {
+	var pages [][]string
+	for {
+		start := bytes.Index(b, []byte("stream\n"))
+		if start < 0 {
+			return pages, nil
+		}
+		b = b[start+len("stream\n"):]
+		end := bytes.Index(b, []byte("\nendstream"))
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated stream")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(b[:end]))
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, showStrings(content))
+		b = b[end+len("\nendstream"):]
+	}
+}
+
+// showStrings returns the strings shown with Tj in a content stream
+func showStrings(content []byte) []string {
+	var lines []string
+	for i := 0; i < len(content); i++ {
+		if content[i] != '(' {
+			continue
+		}
+		var s []byte
+		depth := 1
+		for i++; i < len(content); i++ {
+			c := content[i]
+			if c == '\\' && i+1 < len(content) {
+				i++
+				switch c = content[i]; c {
+				case 'n':
+					c = '\n'
+				case 'r':
+					c = '\r'
+				case 't':
+					c = '\t'
+				}
+				s = append(s, c)
+				continue
+			}
+			if c == '(' {
+				depth++
+			}
+			if c == ')' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+			s = append(s, c)
+		}
+		if i < len(content) && bytes.HasPrefix(bytes.TrimLeft(content[i+1:], " "), []byte("Tj")) {
+			lines = append(lines, decodeWindows1252(s))
+		}
+	}
+	return lines
+}
+
+// decodeWindows1252 decodes the Windows-1252 characters the resumes use,
+// the rest of the range matches Latin-1
+func decodeWindows1252(b []byte) string {
+	special := map[byte]rune{
+		0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+		0x95: '•', 0x96: '–', 0x97: '—', 0x85: '…',
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		if r, ok := special[c]; ok {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
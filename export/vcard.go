@@ -0,0 +1,83 @@
+package export
+
+import (
+	"strings"
+
+	"profile.com/models"
+)
+
+// vCardLineLength is the longest a content line may be before folding
+const vCardLineLength = 75
+
+// VCard maps a profile to an RFC 6350 vCard. Like JSONResume the profile
+// should come from models.ProfileService.View, url is the public address
+// of the profile
+func VCard(profile *models.Profile, url string) string {
+	user := profile.User
+	var b strings.Builder
+	line := func(name, value string) {
+		writeVCardLine(&b, name+":"+value)
+	}
+	line("BEGIN", "VCARD")
+	line("VERSION", "4.0")
+	line("FN", escapeVCard(user.Name))
+	family, given := splitName(user.Name)
+	line("N", escapeVCard(family)+";"+escapeVCard(given)+";;;")
+	if user.Username != "" {
+		line("NICKNAME", escapeVCard(user.Username))
+	}
+	if user.Email != "" {
+		line("EMAIL;TYPE=work", escapeVCard(user.Email))
+	}
+	if user.Title != "" {
+		line("TITLE", escapeVCard(user.Title))
+	}
+	if url != "" {
+		line("URL;TYPE=home", url)
+	}
+	for _, p := range profile.Projects {
+		if p.URL != "" {
+			line("URL;TYPE=work", p.URL)
+		}
+	}
+	line("END", "VCARD")
+	return b.String()
+}
+
+// splitName guesses the family and given names from a full name, taking
+// the last word as the family name
+func splitName(name string) (string, string) {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return name, ""
+	}
+	return fields[len(fields)-1], strings.Join(fields[:len(fields)-1], " ")
+}
+
+// escapeVCard escapes a text value as RFC 6350 section 3.4 asks
+func escapeVCard(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeVCardLine writes a content line, folding it so no line is longer
+// than 75 octets without splitting a UTF-8 sequence
+func writeVCardLine(b *strings.Builder, line string) {
+	limit := vCardLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space which counts towards the limit
+		limit = vCardLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
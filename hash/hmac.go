@@ -3,27 +3,59 @@ package hash
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
-	"hash"
+	"time"
 )
 
-// HMAC creates and returns a new HMAC object
+// HMAC hashes with the active key of a keyring, and checks against every
+// key still in its grace period. It is safe for concurrent use, each hash
+// gets its own hash.Hash
 type HMAC struct {
-	hmac hash.Hash
+	// keys holds the active key first
+	keys []Key
 }
 
-// NewHMAC is a wrapper around the crypto/hmac
+// NewHMAC returns an HMAC with key as its only key
 func NewHMAC(key string) HMAC {
-	h := hmac.New(sha256.New, []byte(key))
 	return HMAC{
-		hmac: h,
+		keys: []Key{{ID: LegacyKeyID, Secret: key}},
 	}
 }
 
-// Hash will hash the provided input strin using HMAC with the secret key
+// Hash will hash the provided input string using HMAC with the active key
 func (h HMAC) Hash(input string) string {
-	h.hmac.Reset()
-	h.hmac.Write([]byte(input))
-	b := h.hmac.Sum(nil)
-	return base64.URLEncoding.EncodeToString(b)
+	return sum(h.keys[0].Secret, input)
+}
+
+// Hashes hashes input with every key that has not retired yet, active key
+// first, so records hashed before a rotation can still be looked up
+func (h HMAC) Hashes(input string) []string {
+	now := time.Now()
+	hashes := make([]string, 0, len(h.keys))
+	for i, k := range h.keys {
+		if i > 0 && k.Retired(now) {
+			continue
+		}
+		hashes = append(hashes, sum(k.Secret, input))
+	}
+	return hashes
+}
+
+// Equal reports whether hash is the hash of input under any key that has
+// not retired yet
+func (h HMAC) Equal(input, hash string) bool {
+	ok := false
+	for _, candidate := range h.Hashes(input) {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func sum(key, input string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(input))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
 }
@@ -0,0 +1,203 @@
+package hash
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// LegacyKeyID is the ID of the single HMAC key used before keyrings,
+	// it is the first key of a keyring seeded from it
+	LegacyKeyID = "1"
+
+	// keySecretBytes is the size of generated keys
+	keySecretBytes = 32
+)
+
+var (
+	// ErrKeyringInvalid is returned when a keyring does not have exactly one
+	// active key, or has keys without an ID or secret
+	ErrKeyringInvalid = errors.New("hash: Keyring needs exactly one active key, and an ID and secret for every key")
+	// ErrKeyNotFound is returned when no key has the given ID
+	ErrKeyNotFound = errors.New("hash: No key with that ID")
+	// ErrKeyActive is returned when retiring the key new hashes are made with
+	ErrKeyActive = errors.New("hash: The active key cannot be retired, rotate first")
+)
+
+// Key is one key of an HMAC keyring
+type Key struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	// RetiresAt is set when a newer key takes over, hashes made with the
+	// key are accepted until then
+	RetiresAt *time.Time `json:"retires_at,omitempty"`
+}
+
+// Active reports whether new hashes are made with the key
+func (k Key) Active() bool {
+	return k.RetiresAt == nil
+}
+
+// Retired reports whether the grace period of the key is over
+func (k Key) Retired(now time.Time) bool {
+	return k.RetiresAt != nil && !now.Before(*k.RetiresAt)
+}
+
+// Keyring holds the HMAC keys, stored as a JSON file only the app can read
+type Keyring struct {
+	Keys []Key `json:"keys"`
+}
+
+// NewKeyring returns a keyring with secret as its active key
+func NewKeyring(secret string) *Keyring {
+	return &Keyring{
+		Keys: []Key{{ID: LegacyKeyID, Secret: secret, CreatedAt: time.Now()}},
+	}
+}
+
+// LoadKeyring reads the keyring at path
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kr Keyring
+	if err := json.Unmarshal(b, &kr); err != nil {
+		return nil, err
+	}
+	if err := kr.validate(); err != nil {
+		return nil, err
+	}
+	return &kr, nil
+}
+
+// Save writes the keyring to path. It writes a temporary file first, so a
+// crash never leaves a half written keyring behind
+func (kr *Keyring) Save(path string) error {
+	if err := kr.validate(); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(kr, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Rotate adds a new random key and makes it active. The old active key is
+// still accepted for grace, which should outlast the longest lived token
+func (kr *Keyring) Rotate(grace time.Duration) (Key, error) {
+	if err := kr.validate(); err != nil {
+		return Key{}, err
+	}
+	b := make([]byte, keySecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, err
+	}
+	now := time.Now()
+	retiresAt := now.Add(grace)
+	next := 0
+	for i, k := range kr.Keys {
+		if k.Active() {
+			kr.Keys[i].RetiresAt = &retiresAt
+		}
+		if n, err := strconv.Atoi(k.ID); err == nil && n > next {
+			next = n
+		}
+	}
+	key := Key{
+		ID:        strconv.Itoa(next + 1),
+		Secret:    base64.URLEncoding.EncodeToString(b),
+		CreatedAt: now,
+	}
+	kr.Keys = append(kr.Keys, key)
+	return key, nil
+}
+
+// Retire removes the key with id straight away, without waiting for its
+// grace period
+func (kr *Keyring) Retire(id string) error {
+	for i, k := range kr.Keys {
+		if k.ID != id {
+			continue
+		}
+		if k.Active() {
+			return ErrKeyActive
+		}
+		kr.Keys = append(kr.Keys[:i], kr.Keys[i+1:]...)
+		return nil
+	}
+	return ErrKeyNotFound
+}
+
+// Prune removes the keys whose grace period is over and returns them
+func (kr *Keyring) Prune() []Key {
+	now := time.Now()
+	var kept, pruned []Key
+	for _, k := range kr.Keys {
+		if k.Retired(now) {
+			pruned = append(pruned, k)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	kr.Keys = kept
+	return pruned
+}
+
+// HMAC returns an HMAC using the keys of the keyring
+func (kr *Keyring) HMAC() (HMAC, error) {
+	if err := kr.validate(); err != nil {
+		return HMAC{}, err
+	}
+	var h HMAC
+	for _, k := range kr.Keys {
+		if k.Active() {
+			h.keys = append([]Key{k}, h.keys...)
+			continue
+		}
+		h.keys = append(h.keys, k)
+	}
+	return h, nil
+}
+
+func (kr *Keyring) validate() error {
+	active := 0
+	ids := map[string]bool{}
+	for _, k := range kr.Keys {
+		if k.ID == "" || k.Secret == "" || ids[k.ID] {
+			return ErrKeyringInvalid
+		}
+		ids[k.ID] = true
+		if k.Active() {
+			active++
+		}
+	}
+	if active != 1 {
+		return ErrKeyringInvalid
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package hash
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustHMAC(t *testing.T, kr *Keyring) HMAC {
+	t.Helper()
+	h, err := kr.HMAC()
+	if err != nil {
+		t.Fatalf("HMAC() error = %v", err)
+	}
+	return h
+}
+
+func TestKeyringRotation(t *testing.T) {
+	const token = "session-token"
+	kr := NewKeyring("legacy-secret")
+	before := mustHMAC(t, kr)
+	oldHash := before.Hash(token)
+	if oldHash != NewHMAC("legacy-secret").Hash(token) {
+		t.Fatal("a keyring seeded from the HMAC key hashes differently from NewHMAC")
+	}
+
+	key, err := kr.Rotate(time.Hour)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if key.ID != "2" || !key.Active() || key.Secret == "" {
+		t.Errorf("Rotate() = %+v, want an active key 2 with a secret", key)
+	}
+	if kr.Keys[0].Active() || kr.Keys[0].Retired(time.Now()) {
+		t.Error("old key should be in its grace period")
+	}
+
+	// during the grace period new hashes use the new key, and the old hash
+	// still matches
+	during := mustHMAC(t, kr)
+	newHash := during.Hash(token)
+	if newHash == oldHash {
+		t.Fatal("Hash() still uses the old key after Rotate()")
+	}
+	if got := during.Hashes(token); !reflect.DeepEqual(got, []string{newHash, oldHash}) {
+		t.Errorf("Hashes() = %q, want the new hash then the old one", got)
+	}
+	if !during.Equal(token, oldHash) || !during.Equal(token, newHash) {
+		t.Error("Equal() rejects a hash made with a key in its grace period")
+	}
+	if pruned := kr.Prune(); len(pruned) != 0 {
+		t.Errorf("Prune() removed %d keys still in their grace period", len(pruned))
+	}
+
+	// once retired only the new key is accepted
+	if err := kr.Retire("2"); err != ErrKeyActive {
+		t.Errorf("Retire(active) error = %v, want %v", err, ErrKeyActive)
+	}
+	if err := kr.Retire("9"); err != ErrKeyNotFound {
+		t.Errorf("Retire(unknown) error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if err := kr.Retire(LegacyKeyID); err != nil {
+		t.Fatalf("Retire() error = %v", err)
+	}
+	after := mustHMAC(t, kr)
+	if got := after.Hashes(token); !reflect.DeepEqual(got, []string{newHash}) {
+		t.Errorf("Hashes() after Retire() = %q, want only the new hash", got)
+	}
+	if after.Equal(token, oldHash) {
+		t.Error("Equal() accepts a hash made with a retired key")
+	}
+}
+
+func TestKeyringGracePeriodEnds(t *testing.T) {
+	const token = "api-token"
+	kr := NewKeyring("legacy-secret")
+	oldHash := mustHMAC(t, kr).Hash(token)
+	if _, err := kr.Rotate(0); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	// the old key is still on the keyring but no longer accepted
+	h := mustHMAC(t, kr)
+	if got := h.Hashes(token); len(got) != 1 || got[0] == oldHash {
+		t.Errorf("Hashes() = %q, want only the new key's hash", got)
+	}
+	if h.Equal(token, oldHash) {
+		t.Error("Equal() accepts a hash made with a key past its grace period")
+	}
+
+	pruned := kr.Prune()
+	if len(pruned) != 1 || pruned[0].ID != LegacyKeyID {
+		t.Errorf("Prune() = %+v, want the legacy key", pruned)
+	}
+	if len(kr.Keys) != 1 || kr.Keys[0].ID != "2" {
+		t.Errorf("keys after Prune() = %+v, want only key 2", kr.Keys)
+	}
+}
+
+func TestKeyringRotateTwice(t *testing.T) {
+	kr := NewKeyring("legacy-secret")
+	if _, err := kr.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	firstRetires := *kr.Keys[0].RetiresAt
+	if _, err := kr.Rotate(2 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	active := 0
+	for _, k := range kr.Keys {
+		ids = append(ids, k.ID)
+		if k.Active() {
+			active++
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) || active != 1 {
+		t.Errorf("keys %v with %d active, want 1, 2, 3 with one active", ids, active)
+	}
+	if !kr.Keys[0].RetiresAt.Equal(firstRetires) {
+		t.Error("a second rotation moved the end of the first key's grace period")
+	}
+	// the active key comes first, then every key still in its grace period
+	if got := mustHMAC(t, kr).Hashes("token"); len(got) != 3 || got[0] != sum(kr.Keys[2].Secret, "token") {
+		t.Errorf("Hashes() = %q, want three hashes led by the active key", got)
+	}
+}
+
+func TestKeyringSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	kr := NewKeyring("legacy-secret")
+	if _, err := kr.Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := kr.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("keyring mode = %v, want 0600", info.Mode().Perm())
+	}
+	loaded, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring() error = %v", err)
+	}
+	want, got := mustHMAC(t, kr), mustHMAC(t, loaded)
+	if !reflect.DeepEqual(got.Hashes("token"), want.Hashes("token")) {
+		t.Error("loaded keyring hashes differently from the saved one")
+	}
+
+	// a keyring with two active keys is refused
+	loaded.Keys[0].RetiresAt = nil
+	if err := loaded.Save(path); err != ErrKeyringInvalid {
+		t.Errorf("Save() error = %v, want %v", err, ErrKeyringInvalid)
+	}
+	if _, err := loaded.HMAC(); err != ErrKeyringInvalid {
+		t.Errorf("HMAC() error = %v, want %v", err, ErrKeyringInvalid)
+	}
+}
@@ -0,0 +1,281 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Bcrypt is the bcrypt password hashing algorithm
+	Bcrypt = "bcrypt"
+	// Argon2id is the argon2id password hashing algorithm
+	Argon2id = "argon2id"
+
+	// LegacyPepperID is the pepper of hashes made before peppers had IDs,
+	// they are plain bcrypt hashes of the password with the pepper appended
+	LegacyPepperID = "1"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	// ErrPasswordMismatch is returned when the password does not match the hash
+	ErrPasswordMismatch = errors.New("hash: Password does not match")
+	// ErrHashFormat is returned when a stored hash cannot be parsed
+	ErrHashFormat = errors.New("hash: Unknown password hash format")
+	// ErrPepperUnknown is returned when a hash was made with a pepper that
+	// is no longer configured
+	ErrPepperUnknown = errors.New("hash: Password hash uses an unknown pepper")
+	// ErrAlgorithmInvalid is returned for an unsupported algorithm
+	ErrAlgorithmInvalid = errors.New("hash: Algorithm must be bcrypt or argon2id")
+	// ErrPepperIDInvalid is returned for an empty pepper ID or one with
+	// characters that would break the hash format
+	ErrPepperIDInvalid = errors.New("hash: Pepper IDs must be letters, digits, - or _")
+)
+
+// Argon2Params are the argon2id cost parameters, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// PasswordOptions configures a PasswordHasher. New hashes use Algorithm
+// and the pepper PepperID, Peppers holds it along with the retired ones
+// that older hashes may still use
+type PasswordOptions struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+	PepperID   string
+	Peppers    map[string]string
+}
+
+// PasswordHasher hashes passwords with the current algorithm, cost and
+// pepper, and checks hashes made with any earlier ones. Hashes record all
+// three so outdated ones can be spotted and upgraded:
+//
+//	$bcrypt$keyid=<pepper id>$2a$<cost>$<bcrypt salt and hash>
+//	$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>,keyid=<pepper id>$<salt>$<hash>
+//
+// The password is HMACed with the pepper before hashing, so long
+// passwords are not cut short by bcrypt's 72 byte limit
+type PasswordHasher struct {
+	opts PasswordOptions
+}
+
+// NewPasswordHasher checks the options and returns the password hasher
+func NewPasswordHasher(opts PasswordOptions) (*PasswordHasher, error) {
+	switch opts.Algorithm {
+	case Bcrypt:
+		if opts.BcryptCost < bcrypt.MinCost || opts.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("hash: Bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		a := opts.Argon2
+		if a.Memory < 8*uint32(a.Parallelism) || a.Iterations < 1 || a.Parallelism < 1 {
+			return nil, errors.New("hash: Argon2 needs at least one iteration and thread, and 8 KiB of memory per thread")
+		}
+	default:
+		return nil, ErrAlgorithmInvalid
+	}
+	for id := range opts.Peppers {
+		if !validPepperID(id) {
+			return nil, ErrPepperIDInvalid
+		}
+	}
+	if _, ok := opts.Peppers[opts.PepperID]; !ok {
+		return nil, ErrPepperUnknown
+	}
+	return &PasswordHasher{
+		opts: opts,
+	}, nil
+}
+
+// validPepperID reports whether id can be written into a hash
+func validPepperID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash hashes password with the current algorithm and pepper
+func (ph *PasswordHasher) Hash(password string) (string, error) {
+	id := ph.opts.PepperID
+	peppered := ph.pepper(password, ph.opts.Peppers[id])
+	if ph.opts.Algorithm == Bcrypt {
+		b, err := bcrypt.GenerateFromPassword(peppered, ph.opts.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return "$bcrypt$keyid=" + id + string(b), nil
+	}
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	a := ph.opts.Argon2
+	key := argon2.IDKey(peppered, salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d,keyid=%s$%s$%s", argon2.Version,
+		a.Memory, a.Iterations, a.Parallelism, id,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Compare checks password against hash, returning ErrPasswordMismatch
+// when it is wrong
+func (ph *PasswordHasher) Compare(hash, password string) error {
+	p, err := parsePasswordHash(hash)
+	if err != nil {
+		return err
+	}
+	pepper, ok := ph.opts.Peppers[p.pepperID]
+	if !ok {
+		return ErrPepperUnknown
+	}
+	switch p.algorithm {
+	case Bcrypt:
+		var peppered []byte
+		if p.legacy {
+			peppered = []byte(password + pepper)
+		} else {
+			peppered = ph.pepper(password, pepper)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(p.bcrypt), peppered); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				return ErrPasswordMismatch
+			}
+			return err
+		}
+		return nil
+	default:
+		a := p.argon2
+		key := argon2.IDKey(ph.pepper(password, pepper), p.salt, a.Iterations, a.Memory, a.Parallelism, uint32(len(p.key)))
+		if subtle.ConstantTimeCompare(key, p.key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+}
+
+// NeedsRehash reports whether hash was made with another algorithm, cost
+// or pepper than the current ones
+func (ph *PasswordHasher) NeedsRehash(hash string) bool {
+	p, err := parsePasswordHash(hash)
+	if err != nil {
+		return true
+	}
+	if p.legacy || p.algorithm != ph.opts.Algorithm || p.pepperID != ph.opts.PepperID {
+		return true
+	}
+	if p.algorithm == Bcrypt {
+		cost, err := bcrypt.Cost([]byte(p.bcrypt))
+		return err != nil || cost != ph.opts.BcryptCost
+	}
+	return p.argon2 != ph.opts.Argon2 || len(p.key) != argon2KeyLength
+}
+
+// pepper HMACs password with the pepper
+func (ph *PasswordHasher) pepper(password, pepper string) []byte {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(password))
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// passwordHash is a parsed stored hash
+type passwordHash struct {
+	algorithm string
+	pepperID  string
+	// legacy is set for bare bcrypt hashes with the pepper appended
+	legacy bool
+	bcrypt string
+	argon2 Argon2Params
+	salt   []byte
+	key    []byte
+}
+
+func parsePasswordHash(hash string) (*passwordHash, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return &passwordHash{
+			algorithm: Bcrypt,
+			pepperID:  LegacyPepperID,
+			legacy:    true,
+			bcrypt:    hash,
+		}, nil
+	case strings.HasPrefix(hash, "$bcrypt$keyid="):
+		rest := strings.TrimPrefix(hash, "$bcrypt$keyid=")
+		i := strings.IndexByte(rest, '$')
+		if i < 1 {
+			return nil, ErrHashFormat
+		}
+		return &passwordHash{
+			algorithm: Bcrypt,
+			pepperID:  rest[:i],
+			bcrypt:    rest[i:],
+		}, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		parts := strings.Split(hash, "$")
+		if len(parts) != 6 || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+			return nil, ErrHashFormat
+		}
+		p := &passwordHash{
+			algorithm: Argon2id,
+		}
+		for _, param := range strings.Split(parts[3], ",") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				return nil, ErrHashFormat
+			}
+			if kv[0] == "keyid" {
+				p.pepperID = kv[1]
+				continue
+			}
+			n, err := strconv.ParseUint(kv[1], 10, 32)
+			if err != nil {
+				return nil, ErrHashFormat
+			}
+			switch kv[0] {
+			case "m":
+				p.argon2.Memory = uint32(n)
+			case "t":
+				p.argon2.Iterations = uint32(n)
+			case "p":
+				if n > 255 {
+					return nil, ErrHashFormat
+				}
+				p.argon2.Parallelism = uint8(n)
+			default:
+				return nil, ErrHashFormat
+			}
+		}
+		var err error
+		if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+			return nil, ErrHashFormat
+		}
+		if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+			return nil, ErrHashFormat
+		}
+		if p.pepperID == "" || p.argon2.Iterations < 1 || p.argon2.Parallelism < 1 {
+			return nil, ErrHashFormat
+		}
+		return p, nil
+	}
+	return nil, ErrHashFormat
+}
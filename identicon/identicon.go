@@ -0,0 +1,132 @@
+package identicon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+)
+
+const (
+	// grid is the number of cells across, the left half is mirrored onto
+	// the right so the pattern is symmetric
+	grid = 5
+	// padding is the margin around the grid in cells
+	padding = 0.5
+)
+
+// background is shared by every identicon
+var background = color.NRGBA{R: 240, G: 240, B: 240, A: 255}
+
+// Identicon is a symmetric pattern and colour derived from a seed, the
+// same seed always giving the same picture
+type Identicon struct {
+	cells [grid][grid]bool
+	color color.NRGBA
+}
+
+// New returns the identicon for seed
+func New(seed string) *Identicon {
+	sum := sha256.Sum256([]byte(seed))
+	icon := &Identicon{
+		color: hslColor(float64(int(sum[0])<<8|int(sum[1]))/65536, 0.45+float64(sum[2])/255*0.2, 0.45+float64(sum[3])/255*0.15),
+	}
+	bit := 0
+	for y := 0; y < grid; y++ {
+		for x := 0; x < (grid+1)/2; x++ {
+			on := sum[4+bit/8]&(1<<uint(bit%8)) != 0
+			icon.cells[y][x] = on
+			icon.cells[y][grid-1-x] = on
+			bit++
+		}
+	}
+	return icon
+}
+
+// ForUser returns the identicon of the user with id
+func ForUser(id uint) *Identicon {
+	return New(fmt.Sprintf("user:%d", id))
+}
+
+// SVG renders the identicon as an SVG image that scales to its container
+func (i *Identicon) SVG() string {
+	var b strings.Builder
+	size := float64(grid) + 2*padding
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %g %g" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&b, `<rect width="%g" height="%g" fill="%s"/>`, size, size, hex(background))
+	fmt.Fprintf(&b, `<path fill="%s" d="`, hex(i.color))
+	for y, row := range i.cells {
+		for x, on := range row {
+			if on {
+				fmt.Fprintf(&b, "M%g %gh1v1h-1z", float64(x)+padding, float64(y)+padding)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
+
+// PNG renders the identicon as a PNG image size pixels square
+func (i *Identicon) PNG(size int) ([]byte, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	cell := float64(size) / (float64(grid) + 2*padding)
+	fg := &image.Uniform{C: i.color}
+	for y, row := range i.cells {
+		for x, on := range row {
+			if !on {
+				continue
+			}
+			r := image.Rect(
+				int((float64(x)+padding)*cell+0.5), int((float64(y)+padding)*cell+0.5),
+				int((float64(x)+1+padding)*cell+0.5), int((float64(y)+1+padding)*cell+0.5),
+			)
+			draw.Draw(img, r, fg, image.Point{}, draw.Src)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hex(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// hslColor converts a hue, saturation and lightness between 0 and 1 to RGB
+func hslColor(h, s, l float64) color.NRGBA {
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	channel := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(v*255 + 0.5)
+	}
+	return color.NRGBA{R: channel(h + 1.0/3), G: channel(h), B: channel(h - 1.0/3), A: 255}
+}
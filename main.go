@@ -1,12 +1,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
+	"profile.com/config"
+	"profile.com/email"
 	"profile.com/middleware"
 
 	"profile.com/models"
+	"profile.com/storage"
 
 	"profile.com/controllers"
 
@@ -14,46 +22,293 @@ import (
 	_ "github.com/lib/pq"
 )
 
-const serverPort = ":8080"
-
-const (
-	host   = "localhost"
-	port   = 5432
-	user   = "postgres"
-	dbname = "profile_dev"
-)
-
 func main() {
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		" dbname=%s sslmode=disable",
-		host, port, user, dbname)
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
 
-	services, err := models.NewServices(psqlInfo)
+	if len(args) > 0 && args[0] == "keys" {
+		if err := runKeys(cfg, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	blob, err := newBlob(cfg)
+	if err != nil {
+		panic(err)
+	}
+	services, err := models.NewServices(cfg, blob)
 	if err != nil {
 		panic(err)
 	}
-	services.AutoMigrate()
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(services, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := services.Migrate(); err != nil {
+		panic(err)
+	}
+
+	mailer := email.NewLogMailer(os.Stdout)
 
 	staticC := controllers.NewStatic()
-	userC := controllers.NewUser(services.User)
+	cookies := middleware.NewCookies(cfg.Cookie)
+	userC := controllers.NewUser(services, mailer, cookies, cfg.BaseURL)
+	sectionsC := controllers.NewSections(services)
 
 	requireUserMW := middleware.NewRequireUserMiddleWare(services.User)
-	userMW := middleware.NewUserMiddleWare(services.User)
-	dashboard := requireUserMW.ApplyFn(userC.Dashboard)
+	requireVerifiedMW := middleware.NewRequireVerifiedMiddleWare(services.User)
+	userMW := middleware.NewUserMiddleWare(services.Session, cookies)
+	tokenMW := middleware.NewTokenMiddleWare(services.APIToken)
+	csrfMW := middleware.NewCSRFMiddleWare(services.HMAC, cookies)
+	readProfileMW := middleware.NewRequireScopeMiddleWare(models.ScopeProfileRead)
+	writeProfileMW := middleware.NewRequireScopeMiddleWare(models.ScopeProfileWrite)
+	signupLimitMW := middleware.NewRateLimitMiddleWare(services.Buckets, "signup",
+		models.RateLimit{Requests: 10, Per: time.Hour}, middleware.ByIP)
+	directoryLimitMW := middleware.NewRateLimitMiddleWare(services.Buckets, "directory",
+		models.RateLimit{Requests: 60, Per: time.Minute}, middleware.ByUser)
+	apiLimitMW := middleware.NewRateLimitMiddleWare(services.Buckets, "api",
+		models.RateLimit{Requests: 600, Per: time.Minute, Burst: 100}, middleware.ByAPIToken)
+	dashboard := requireVerifiedMW.ApplyFn(userC.Dashboard)
 	completeProfile := requireUserMW.ApplyFn(userC.CompleteProfile)
 	profile := requireUserMW.ApplyFn(userC.Profile)
+	resendVerification := requireUserMW.ApplyFn(userC.ResendVerification)
+	logoutAll := requireUserMW.ApplyFn(userC.LogoutAll)
+	devices := requireUserMW.ApplyFn(userC.Devices)
+	revokeDevice := requireUserMW.ApplyFn(userC.RevokeDevice)
+	twoFactor := requireUserMW.ApplyFn(userC.TwoFactor)
+	twoFactorQR := requireUserMW.ApplyFn(userC.TwoFactorQR)
+	setupTwoFactor := requireUserMW.ApplyFn(userC.SetupTwoFactor)
+	enableTwoFactor := requireUserMW.ApplyFn(userC.EnableTwoFactor)
+	disableTwoFactor := requireUserMW.ApplyFn(userC.DisableTwoFactor)
+	regenerateRecoveryCodes := requireUserMW.ApplyFn(userC.RegenerateRecoveryCodes)
+	tokens := requireUserMW.ApplyFn(userC.Tokens)
+	createToken := requireUserMW.ApplyFn(userC.CreateToken)
+	revokeToken := requireUserMW.ApplyFn(userC.RevokeToken)
+	apiMe := apiLimitMW.ApplyFn(requireUserMW.ApplyFn(readProfileMW.ApplyFn(userC.APIMe)))
+	apiUpdateMe := apiLimitMW.ApplyFn(requireUserMW.ApplyFn(writeProfileMW.ApplyFn(userC.APIUpdateMe)))
 
 	r := mux.NewRouter()
 	r.HandleFunc("/", staticC.Home).Methods("GET")
 	r.HandleFunc("/signup", userC.New).Methods("GET")
-	r.HandleFunc("/signup", userC.Register).Methods("POST")
+	r.HandleFunc("/signup", signupLimitMW.ApplyFn(userC.Register)).Methods("POST")
 	r.HandleFunc("/login", userC.Login).Methods("GET")
 	r.HandleFunc("/login", userC.HandleLogin).Methods("POST")
+	r.HandleFunc("/login/2fa", userC.LoginTwoFactor).Methods("GET")
+	r.HandleFunc("/login/2fa", userC.HandleLoginTwoFactor).Methods("POST")
+	r.HandleFunc("/logout", userC.Logout).Methods("POST")
+	r.HandleFunc("/logout/all", logoutAll).Methods("POST")
+	r.HandleFunc("/devices", devices).Methods("GET")
+	r.HandleFunc("/devices/{id:[0-9]+}/revoke", revokeDevice).Methods("POST")
+	r.HandleFunc("/2fa", twoFactor).Methods("GET")
+	r.HandleFunc("/2fa/qr.png", twoFactorQR).Methods("GET")
+	r.HandleFunc("/2fa/setup", setupTwoFactor).Methods("POST")
+	r.HandleFunc("/2fa/enable", enableTwoFactor).Methods("POST")
+	r.HandleFunc("/2fa/disable", disableTwoFactor).Methods("POST")
+	r.HandleFunc("/2fa/recovery-codes", regenerateRecoveryCodes).Methods("POST")
+	r.HandleFunc("/tokens", tokens).Methods("GET")
+	r.HandleFunc("/tokens", createToken).Methods("POST")
+	r.HandleFunc("/tokens/{id:[0-9]+}/revoke", revokeToken).Methods("POST")
+	r.HandleFunc("/forgot", userC.Forgot).Methods("GET")
+	r.HandleFunc("/forgot", userC.HandleForgot).Methods("POST")
+	r.HandleFunc("/reset", userC.Reset).Methods("GET")
+	r.HandleFunc("/reset", userC.HandleReset).Methods("POST")
+	r.HandleFunc("/verify", userC.Verify).Methods("GET")
+	r.HandleFunc("/unlock", userC.Unlock).Methods("GET")
+	r.HandleFunc("/verify", resendVerification).Methods("POST")
 	r.HandleFunc("/complete-profile", completeProfile).Queries("email", "{email}").Methods("GET")
 	r.HandleFunc("/complete-profile", profile).Queries("email", "{email}").Methods("POST")
 	r.HandleFunc("/dashboard", dashboard).Methods("GET")
-	r.HandleFunc("/users", userC.Users).Methods("GET")
+	r.HandleFunc("/dashboard/resume.json", requireUserMW.ApplyFn(userC.DashboardResume)).Methods("GET")
+	r.HandleFunc("/dashboard/resume.pdf", requireUserMW.ApplyFn(userC.DashboardResumePDF)).Methods("GET")
+	r.HandleFunc("/dashboard/import", requireUserMW.ApplyFn(userC.ImportResume)).Methods("POST")
+	r.HandleFunc("/dashboard/avatar", requireUserMW.ApplyFn(userC.UploadAvatar)).Methods("POST")
+	r.HandleFunc("/dashboard/avatar/delete", requireUserMW.ApplyFn(userC.RemoveAvatar)).Methods("POST")
+	r.HandleFunc("/dashboard/privacy", requireUserMW.ApplyFn(userC.Privacy)).Methods("GET")
+	r.HandleFunc("/dashboard/privacy", requireUserMW.ApplyFn(userC.UpdatePrivacy)).Methods("POST")
+	r.HandleFunc("/dashboard/privacy/share", requireUserMW.ApplyFn(userC.RegenerateShareLink)).Methods("POST")
+	r.HandleFunc("/dashboard/skills", requireUserMW.ApplyFn(userC.AddSkill)).Methods("POST")
+	r.HandleFunc("/dashboard/skills/{id:[0-9]+}/update", requireUserMW.ApplyFn(userC.UpdateSkill)).Methods("POST")
+	r.HandleFunc("/dashboard/skills/{id:[0-9]+}/delete", requireUserMW.ApplyFn(userC.DeleteSkill)).Methods("POST")
+	r.HandleFunc("/dashboard/experience/new", requireUserMW.ApplyFn(sectionsC.NewExperience)).Methods("GET")
+	r.HandleFunc("/dashboard/experience", requireUserMW.ApplyFn(sectionsC.CreateExperience)).Methods("POST")
+	r.HandleFunc("/dashboard/experience/{id:[0-9]+}/edit", requireUserMW.ApplyFn(sectionsC.EditExperience)).Methods("GET")
+	r.HandleFunc("/dashboard/experience/{id:[0-9]+}/update", requireUserMW.ApplyFn(sectionsC.UpdateExperience)).Methods("POST")
+	r.HandleFunc("/dashboard/experience/{id:[0-9]+}/delete", requireUserMW.ApplyFn(sectionsC.DeleteExperience)).Methods("POST")
+	r.HandleFunc("/dashboard/experience/{id:[0-9]+}/move", requireUserMW.ApplyFn(sectionsC.MoveExperience)).Methods("POST")
+	r.HandleFunc("/dashboard/education/new", requireUserMW.ApplyFn(sectionsC.NewEducation)).Methods("GET")
+	r.HandleFunc("/dashboard/education", requireUserMW.ApplyFn(sectionsC.CreateEducation)).Methods("POST")
+	r.HandleFunc("/dashboard/education/{id:[0-9]+}/edit", requireUserMW.ApplyFn(sectionsC.EditEducation)).Methods("GET")
+	r.HandleFunc("/dashboard/education/{id:[0-9]+}/update", requireUserMW.ApplyFn(sectionsC.UpdateEducation)).Methods("POST")
+	r.HandleFunc("/dashboard/education/{id:[0-9]+}/delete", requireUserMW.ApplyFn(sectionsC.DeleteEducation)).Methods("POST")
+	r.HandleFunc("/dashboard/education/{id:[0-9]+}/move", requireUserMW.ApplyFn(sectionsC.MoveEducation)).Methods("POST")
+	r.HandleFunc("/dashboard/projects/new", requireUserMW.ApplyFn(sectionsC.NewProject)).Methods("GET")
+	r.HandleFunc("/dashboard/projects", requireUserMW.ApplyFn(sectionsC.CreateProject)).Methods("POST")
+	r.HandleFunc("/dashboard/projects/{id:[0-9]+}/edit", requireUserMW.ApplyFn(sectionsC.EditProject)).Methods("GET")
+	r.HandleFunc("/dashboard/projects/{id:[0-9]+}/update", requireUserMW.ApplyFn(sectionsC.UpdateProject)).Methods("POST")
+	r.HandleFunc("/dashboard/projects/{id:[0-9]+}/delete", requireUserMW.ApplyFn(sectionsC.DeleteProject)).Methods("POST")
+	r.HandleFunc("/dashboard/projects/{id:[0-9]+}/move", requireUserMW.ApplyFn(sectionsC.MoveProject)).Methods("POST")
+	r.HandleFunc("/users", directoryLimitMW.ApplyFn(userC.Users)).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}", userC.Public).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}.vcf", userC.VCard).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}/qr.svg", userC.QRCodeSVG).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}/qr.png", userC.QRCodePNG).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}/resume.json", userC.PublicResume).Methods("GET")
+	r.HandleFunc("/u/{username:[a-zA-Z0-9_-]+}/resume.pdf", userC.PublicResumePDF).Methods("GET")
+	r.HandleFunc("/people", directoryLimitMW.ApplyFn(userC.People)).Methods("GET")
+	r.HandleFunc("/avatars/{id:[0-9]+}/{file}", userC.Avatar).Methods("GET")
+	r.HandleFunc("/avatar/{id:[0-9]+}.{ext:svg|png}", userC.Identicon).Methods("GET")
+
+	r.HandleFunc("/api/skills/suggest", userC.SuggestSkills).Methods("GET")
+
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/users", apiLimitMW.ApplyFn(directoryLimitMW.ApplyFn(userC.APIUsers))).Methods("GET")
+	api.HandleFunc("/users/{id:[0-9]+}", apiLimitMW.ApplyFn(userC.APIUser)).Methods("GET")
+	api.HandleFunc("/me", apiMe).Methods("GET")
+	api.HandleFunc("/me", apiUpdateMe).Methods("PATCH")
+	api.HandleFunc("/signup", apiLimitMW.ApplyFn(signupLimitMW.ApplyFn(userC.APISignup))).Methods("POST")
+	api.HandleFunc("/login", apiLimitMW.ApplyFn(userC.APILogin)).Methods("POST")
+
+	fmt.Printf("Listening at %s", cfg.Addr)
+	http.ListenAndServe(cfg.Addr, userMW.Apply(tokenMW.Apply(csrfMW.Apply(r))))
+}
 
-	fmt.Printf("Listening at port %s", serverPort)
-	http.ListenAndServe(serverPort, userMW.Apply(r))
+// newBlob returns the store uploads are kept in
+func newBlob(cfg *config.Config) (storage.Blob, error) {
+	if cfg.Storage == config.StorageS3 {
+		s3, err := storage.NewS3(cfg.S3Options())
+		if err != nil {
+			return nil, err
+		}
+		return s3, nil
+	}
+	disk, err := storage.NewDisk(cfg.UploadsDir)
+	if err != nil {
+		return nil, err
+	}
+	return disk, nil
+}
+
+// migrateUsage is printed when the migrate subcommand is misused
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate handles the migrate subcommand, down rolls back one
+// migration unless told how many
+func runMigrate(services *models.Services, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	m, err := services.Migrator()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		n, err := m.Up()
+		fmt.Printf("Applied %d migrations\n", n)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return errors.New(migrateUsage)
+			}
+		}
+		n, err := m.Down(steps)
+		fmt.Printf("Rolled back %d migrations\n", n)
+		return err
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+// keysUsage is printed when the keys subcommand is misused
+const keysUsage = "usage: keys list | rotate [grace] | retire <id> | prune"
+
+// defaultKeyGrace keeps a rotated key for as long as a session lives, so
+// nobody is signed out by a rotation. Tokens used within it are moved to
+// the new key
+const defaultKeyGrace = 30 * 24 * time.Hour
+
+// runKeys handles the keys subcommand, which manages the HMAC keyring.
+// Restart every instance after a change so they all pick it up
+func runKeys(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+	if cfg.HMACKeyring == "" {
+		return errors.New("keys: set hmac_keyring to the path of the keyring file")
+	}
+	kr, err := cfg.Keyring()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		for _, k := range kr.Keys {
+			status := "active"
+			if !k.Active() {
+				status = "retires " + k.RetiresAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-4s created %s %s\n", k.ID, k.CreatedAt.Format("2006-01-02 15:04:05"), status)
+		}
+		return nil
+	case "rotate":
+		grace := defaultKeyGrace
+		if len(args) > 1 {
+			if grace, err = time.ParseDuration(args[1]); err != nil || grace < 0 {
+				return errors.New(keysUsage)
+			}
+		}
+		key, err := kr.Rotate(grace)
+		if err != nil {
+			return err
+		}
+		if err := kr.Save(cfg.HMACKeyring); err != nil {
+			return err
+		}
+		fmt.Printf("Key %s is now active, older keys are accepted for %s\n", key.ID, grace)
+		return nil
+	case "retire":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		if err := kr.Retire(args[1]); err != nil {
+			return err
+		}
+		if err := kr.Save(cfg.HMACKeyring); err != nil {
+			return err
+		}
+		fmt.Printf("Retired key %s\n", args[1])
+		return nil
+	case "prune":
+		pruned := kr.Prune()
+		if err := kr.Save(cfg.HMACKeyring); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d retired keys\n", len(pruned))
+		return nil
+	}
+	return errors.New(keysUsage)
 }
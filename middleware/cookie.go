@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"profile.com/context"
 	"profile.com/models"
+	"profile.com/views"
 )
 
 // RequireUserMiddleWare defines the shape of the middleware struct
@@ -12,9 +14,15 @@ type RequireUserMiddleWare struct {
 	models.UserService
 }
 
+// RequireVerifiedMiddleWare only lets through users with a verified email
+type RequireVerifiedMiddleWare struct {
+	RequireUserMiddleWare
+}
+
 // UserMiddleWare checks for a logged in user
 type UserMiddleWare struct {
-	models.UserService
+	models.SessionService
+	cookies *Cookies
 }
 
 // NewRequireUserMiddleWare returns the middleware struct
@@ -24,10 +32,20 @@ func NewRequireUserMiddleWare(us models.UserService) *RequireUserMiddleWare {
 	}
 }
 
+// NewRequireVerifiedMiddleWare returns the verified user middleware struct
+func NewRequireVerifiedMiddleWare(us models.UserService) *RequireVerifiedMiddleWare {
+	return &RequireVerifiedMiddleWare{
+		RequireUserMiddleWare: RequireUserMiddleWare{
+			UserService: us,
+		},
+	}
+}
+
 // NewUserMiddleWare returns the user middleware struct
-func NewUserMiddleWare(us models.UserService) *UserMiddleWare {
+func NewUserMiddleWare(ss models.SessionService, cookies *Cookies) *UserMiddleWare {
 	return &UserMiddleWare{
-		UserService: us,
+		SessionService: ss,
+		cookies:        cookies,
 	}
 }
 
@@ -36,6 +54,10 @@ func (mw *RequireUserMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := context.GetUserFromContext(r.Context())
 		if user == nil {
+			if views.WantsJSON(r) || strings.HasPrefix(r.URL.Path, "/api/") {
+				views.RenderJSONError(w, http.StatusUnauthorized, "Please log in")
+				return
+			}
 			http.Redirect(w, r, "login", http.StatusFound)
 			return
 		}
@@ -43,22 +65,38 @@ func (mw *RequireUserMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc
 	})
 }
 
+// ApplyFn is a middleware function that sends signed in but unverified
+// users to the verification page
+func (mw *RequireVerifiedMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return mw.RequireUserMiddleWare.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		user := context.GetUserFromContext(r.Context())
+		if !user.Verified {
+			http.Redirect(w, r, "/verify", http.StatusFound)
+			return
+		}
+		next(w, r)
+	})
+}
+
 // ApplyFn is a middleware function
 func (mw *UserMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("remember_token")
+		cookie, err := r.Cookie(SessionCookie)
 		if err != nil {
 			next(w, r)
 			return
 		}
 
-		user, err := mw.UserService.ByRemember(cookie.Value)
+		user, session, err := mw.SessionService.UserByToken(cookie.Value)
 		if err != nil {
+			mw.cookies.ClearSession(w)
 			next(w, r)
 			return
 		}
+		mw.cookies.SetSession(w, session.Token, session.ExpiresAt)
 
 		ctx := context.SetUserInContext(r.Context(), user)
+		ctx = context.SetSessionInContext(ctx, session)
 		r = r.WithContext(ctx)
 
 		next(w, r)
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"profile.com/context"
+	"profile.com/hash"
+	"profile.com/models"
+	"profile.com/rand"
+	"profile.com/views"
+)
+
+// CSRFHeader is the header scripts send the CSRF token in
+const CSRFHeader = "X-CSRF-Token"
+
+// MaxMultipartSize caps multipart bodies, which are parsed here to find
+// the token. It leaves room for the largest upload, a 5MB avatar
+const MaxMultipartSize = 6 << 20
+
+const (
+	// csrfTokenBytes is the size of the double submit token
+	csrfTokenBytes = 32
+	// multipartMemory is how much of a multipart body is kept in memory,
+	// larger files go to temporary files
+	multipartMemory = 1 << 20
+)
+
+// CSRFMiddleWare rejects state changing requests that do not carry the
+// CSRF token of the visitor. Signed in users get a synchronizer token
+// derived from their session, everyone else a double submit cookie
+type CSRFMiddleWare struct {
+	hmac    hash.HMAC
+	cookies *Cookies
+	view    *views.Views
+}
+
+// NewCSRFMiddleWare returns the CSRF middleware struct, session tokens are
+// signed with hmac
+func NewCSRFMiddleWare(hmac hash.HMAC, cookies *Cookies) *CSRFMiddleWare {
+	return &CSRFMiddleWare{
+		hmac:    hmac,
+		cookies: cookies,
+		view:    views.NewView("bootstrap", "static/forbidden"),
+	}
+}
+
+// ApplyFn is a middleware function. It must run after the user and token
+// middleware so it knows the session and whether a bearer token was used
+func (mw *CSRFMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := mw.token(w, r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			return
+		}
+		if !csrfSafe(r) {
+			defer removeMultipartFiles(r)
+			var tooLarge *http.MaxBytesError
+			if err := parseForm(w, r); errors.As(err, &tooLarge) {
+				tooLargeError(w, r)
+				return
+			}
+			if !mw.valid(r, token) {
+				mw.reject(w, r)
+				return
+			}
+		}
+		r = r.WithContext(context.SetCSRFTokenInContext(r.Context(), token))
+		next(w, r)
+	})
+}
+
+// Apply is a middleware function
+func (mw *CSRFMiddleWare) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// token returns the token the visitor's forms must send back, setting the
+// double submit cookie for visitors who are not signed in and lack one
+func (mw *CSRFMiddleWare) token(w http.ResponseWriter, r *http.Request) (string, error) {
+	if session := context.GetSessionFromContext(r.Context()); session != nil {
+		return mw.sessionToken(session), nil
+	}
+	if cookie, err := r.Cookie(CSRFCookie); err == nil {
+		if n, err := rand.NBytes(cookie.Value); err == nil && n == csrfTokenBytes {
+			return cookie.Value, nil
+		}
+	}
+	token, err := rand.String(csrfTokenBytes)
+	if err != nil {
+		return "", err
+	}
+	mw.cookies.SetCSRF(w, token)
+	return token, nil
+}
+
+// sessionToken signs the session ID, so the token changes with every
+// sign in and cannot be worked out without the HMAC key
+func (mw *CSRFMiddleWare) sessionToken(session *models.Session) string {
+	return mw.hmac.Hash("csrf:" + strconv.FormatUint(uint64(session.ID), 10))
+}
+
+// parseForm parses the body the token field is sent in, unless it came in
+// the header. Multipart bodies are capped at MaxMultipartSize, handlers
+// read their files from the parsed form
+func parseForm(w http.ResponseWriter, r *http.Request) error {
+	if r.Header.Get(CSRFHeader) != "" {
+		return nil
+	}
+	if !hasMediaType(r, "multipart/form-data") {
+		return r.ParseForm()
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxMultipartSize)
+	return r.ParseMultipartForm(multipartMemory)
+}
+
+// removeMultipartFiles removes the temporary files of a parsed multipart
+// form. The server only does so for the request it created, not for the
+// copies middleware hands on
+func removeMultipartFiles(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+// valid reports whether the request carries token in the header, or in
+// the form field
+func (mw *CSRFMiddleWare) valid(r *http.Request, token string) bool {
+	sent := r.Header.Get(CSRFHeader)
+	if sent == "" {
+		sent = r.PostForm.Get(views.CSRFField)
+	}
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// reject renders the expired form page, or a JSON error for API clients
+func (mw *CSRFMiddleWare) reject(w http.ResponseWriter, r *http.Request) {
+	if views.WantsJSON(r) || strings.HasPrefix(r.URL.Path, apiPrefix) {
+		views.RenderJSONError(w, http.StatusForbidden, "Invalid or missing CSRF token")
+		return
+	}
+	w.WriteHeader(http.StatusForbidden)
+	mw.view.Render(w, r, nil)
+}
+
+// tooLargeError tells the client the body was over MaxMultipartSize
+func tooLargeError(w http.ResponseWriter, r *http.Request) {
+	if views.WantsJSON(r) || strings.HasPrefix(r.URL.Path, apiPrefix) {
+		views.RenderJSONError(w, http.StatusRequestEntityTooLarge, "Request is too large")
+		return
+	}
+	http.Error(w, "Request is too large", http.StatusRequestEntityTooLarge)
+}
+
+// csrfSafe reports whether the request can skip the token check: reads,
+// requests signed with a bearer token, which browsers never add on their
+// own, and JSON bodies, which cross-site forms cannot send
+func csrfSafe(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if context.GetAPITokenFromContext(r.Context()) != nil {
+		return true
+	}
+	return hasMediaType(r, "application/json")
+}
+
+// hasMediaType reports whether the request body is of mediaType
+func hasMediaType(r *http.Request, mediaType string) bool {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && t == mediaType
+}
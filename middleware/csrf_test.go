@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"profile.com/config"
+	"profile.com/hash"
+	"profile.com/rand"
+	"profile.com/views"
+)
+
+// TestMain runs the tests from the repository root, where the views are
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// multipartRequest builds an upload carrying token in the csrf_token field
+// when it is not empty, and a file of size bytes
+func multipartRequest(t *testing.T, target, token string, size int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if token != "" {
+		mw.WriteField(views.CSRFField, token)
+	}
+	fw, err := mw.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(make([]byte, size))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestCSRFMultipart(t *testing.T) {
+	token, err := rand.String(csrfTokenBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		target   string
+		token    string
+		size     int
+		wantCode int
+	}{
+		{"token in the form", "/dashboard/avatar", token, 1 << 10, http.StatusOK},
+		{"missing token", "/dashboard/avatar", "", 1 << 10, http.StatusForbidden},
+		{"wrong token", "/dashboard/avatar", "not-the-token", 1 << 10, http.StatusForbidden},
+		{"token in the URL is not accepted", "/dashboard/avatar?csrf_token=" + token, "", 1 << 10, http.StatusForbidden},
+		{"file bigger than memory", "/dashboard/avatar", token, 2 * multipartMemory, http.StatusOK},
+		{"body over the limit", "/dashboard/avatar", token, MaxMultipartSize, http.StatusRequestEntityTooLarge},
+	}
+	csrf := NewCSRFMiddleWare(hash.NewHMAC("secret-key"), NewCookies(config.CookieConfig{}))
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotSize int64
+			handler := csrf.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+				file, header, err := r.FormFile("avatar")
+				if err != nil {
+					t.Errorf("handler FormFile() error = %v", err)
+					return
+				}
+				file.Close()
+				gotSize = header.Size
+			})
+			r := multipartRequest(t, tc.target, tc.token, tc.size)
+			r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: token})
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusOK && gotSize != int64(tc.size) {
+				t.Errorf("handler got a %d byte file, want %d", gotSize, tc.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// KeyFunc picks the bucket a request is counted against
+type KeyFunc func(r *http.Request) string
+
+// ByIP counts requests against the client IP
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByUser counts requests against the signed in user, and visitors
+// against their IP
+func ByUser(r *http.Request) string {
+	if user := context.GetUserFromContext(r.Context()); user != nil {
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return ByIP(r)
+}
+
+// ByAPIToken counts requests against the API token they were made with,
+// falling back to ByUser for everything else
+func ByAPIToken(r *http.Request) string {
+	if token := context.GetAPITokenFromContext(r.Context()); token != nil {
+		return "token:" + strconv.FormatUint(uint64(token.ID), 10)
+	}
+	return ByUser(r)
+}
+
+// RateLimitMiddleWare limits the requests to a route with a token bucket
+// per key. The buckets of each route are kept apart by its name
+type RateLimitMiddleWare struct {
+	store models.BucketStore
+	route string
+	limit models.RateLimit
+	key   KeyFunc
+}
+
+// NewRateLimitMiddleWare returns the rate limit middleware struct
+func NewRateLimitMiddleWare(store models.BucketStore, route string, limit models.RateLimit, key KeyFunc) *RateLimitMiddleWare {
+	return &RateLimitMiddleWare{
+		store: store,
+		route: route,
+		limit: limit,
+		key:   key,
+	}
+}
+
+// ApplyFn is a middleware function. It lets requests through when the
+// store fails, an outage should not take the whole site down with it
+func (mw *RateLimitMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, err := mw.store.Take(mw.route+"|"+mw.key(r), mw.limit)
+		if err != nil {
+			log.Println(err)
+			next(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(bucket.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(bucket.Remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(bucket.Reset))
+		h.Set("RateLimit-Policy", strconv.Itoa(bucket.Limit)+";w="+ceilSeconds(mw.limit.Per))
+		if !bucket.Allowed {
+			h.Set("Retry-After", ceilSeconds(bucket.RetryAfter))
+			if views.WantsJSON(r) || strings.HasPrefix(r.URL.Path, apiPrefix) {
+				views.RenderJSONError(w, http.StatusTooManyRequests, "Too many requests, please slow down")
+				return
+			}
+			http.Error(w, "Too many requests, please slow down", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Apply is a middleware function
+func (mw *RateLimitMiddleWare) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ceilSeconds formats d as whole seconds, rounding up so clients never
+// come back too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"profile.com/config"
+)
+
+// SessionCookie is the name of the cookie holding the session token
+const SessionCookie = "remember_token"
+
+// PendingTwoFactorCookie is the name of the cookie that remembers a user
+// who gave the right password but still has to enter their code
+const PendingTwoFactorCookie = "pending_2fa"
+
+// CSRFCookie is the name of the double submit cookie used by visitors
+// who are not signed in
+const CSRFCookie = "csrf_token"
+
+// Cookies writes the cookies we set with the configured attributes
+type Cookies struct {
+	secure bool
+	domain string
+}
+
+// NewCookies returns the cookie writer for cfg
+func NewCookies(cfg config.CookieConfig) *Cookies {
+	return &Cookies{
+		secure: cfg.Secure,
+		domain: cfg.Domain,
+	}
+}
+
+// set writes an HTTP only cookie, an empty value removes it. SameSite=Lax
+// keeps the cookies off cross-site form posts
+func (c *Cookies) set(w http.ResponseWriter, name, value, path string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.domain,
+		Expires:  expires,
+		Secure:   c.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		cookie.Expires = time.Time{}
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// SetSession writes the session token cookie with the given expiry
+func (c *Cookies) SetSession(w http.ResponseWriter, token string, expires time.Time) {
+	c.set(w, SessionCookie, token, "/", expires)
+}
+
+// ClearSession removes the session token cookie from the browser
+func (c *Cookies) ClearSession(w http.ResponseWriter) {
+	c.set(w, SessionCookie, "", "/", time.Time{})
+}
+
+// SetPendingTwoFactor writes the pending two factor cookie
+func (c *Cookies) SetPendingTwoFactor(w http.ResponseWriter, token string, expires time.Time) {
+	c.set(w, PendingTwoFactorCookie, token, "/login", expires)
+}
+
+// ClearPendingTwoFactor removes the pending two factor cookie
+func (c *Cookies) ClearPendingTwoFactor(w http.ResponseWriter) {
+	c.set(w, PendingTwoFactorCookie, "", "/login", time.Time{})
+}
+
+// SetCSRF writes the double submit cookie, it lasts as long as the browser
+func (c *Cookies) SetCSRF(w http.ResponseWriter, token string) {
+	c.set(w, CSRFCookie, token, "/", time.Time{})
+}
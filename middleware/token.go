@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"profile.com/context"
+	"profile.com/models"
+	"profile.com/views"
+)
+
+// apiPrefix is the only path bearer tokens are accepted on, so a token can
+// never be used to manage sessions or other tokens from the HTML pages
+const apiPrefix = "/api/"
+
+// TokenMiddleWare authenticates API requests with a bearer token
+type TokenMiddleWare struct {
+	models.APITokenService
+}
+
+// RequireScopeMiddleWare rejects token requests missing a scope
+type RequireScopeMiddleWare struct {
+	scope string
+}
+
+// NewTokenMiddleWare returns the token middleware struct
+func NewTokenMiddleWare(ats models.APITokenService) *TokenMiddleWare {
+	return &TokenMiddleWare{
+		APITokenService: ats,
+	}
+}
+
+// NewRequireScopeMiddleWare returns the scope middleware struct
+func NewRequireScopeMiddleWare(scope string) *RequireScopeMiddleWare {
+	return &RequireScopeMiddleWare{
+		scope: scope,
+	}
+}
+
+// ApplyFn is a middleware function
+func (mw *TokenMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, apiPrefix) {
+			next(w, r)
+			return
+		}
+		bearer, ok := BearerToken(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		user, token, err := mw.APITokenService.UserByToken(bearer)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			views.RenderJSONError(w, http.StatusUnauthorized, "Invalid or expired token")
+			return
+		}
+
+		ctx := context.SetUserInContext(r.Context(), user)
+		ctx = context.SetAPITokenInContext(ctx, token)
+		r = r.WithContext(ctx)
+
+		next(w, r)
+	})
+}
+
+// Apply is a middleware function
+func (mw *TokenMiddleWare) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn is a middleware function. Requests signed in with a session
+// cookie are let through since they are not limited by scopes
+func (mw *RequireScopeMiddleWare) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := context.GetAPITokenFromContext(r.Context())
+		if token != nil && !token.HasScope(mw.scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+mw.scope+`"`)
+			views.RenderJSONError(w, http.StatusForbidden, "This token is missing the "+mw.scope+" scope")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// BearerToken returns the token from the Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS profile_visibilities;
+DROP TABLE IF EXISTS username_redirects;
+DROP TABLE IF EXISTS user_skills;
+DROP TABLE IF EXISTS skill_aliases;
+DROP TABLE IF EXISTS skills;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS educations;
+DROP TABLE IF EXISTS experiences;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,232 @@
+-- The schema as gorm's AutoMigrate left it. Every statement is guarded so
+-- it also runs on databases that were auto migrated before, which get the
+-- tables and columns they are missing.
+
+-- Sessions moved to their own table, logging out the old remember tokens
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS remember;
+ALTER TABLE IF EXISTS users DROP COLUMN IF EXISTS remember_hash;
+
+CREATE TABLE IF NOT EXISTS users (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    name text NOT NULL,
+    username text,
+    email text NOT NULL,
+    password_hash text NOT NULL,
+    title text,
+    summary text,
+    skills text,
+    verified boolean NOT NULL DEFAULT false,
+    verified_at timestamp with time zone,
+    totp_secret text,
+    totp_enabled boolean NOT NULL DEFAULT false,
+    avatar text
+);
+-- Columns added to users since the first release, before any index or
+-- later migration uses them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username text;
+-- Users who signed up before email verification existed count as verified,
+-- so the upgrade does not lock them out of their dashboard. Only the rows
+-- there when the column is added get true, new users start unverified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified boolean NOT NULL DEFAULT true;
+ALTER TABLE users ALTER COLUMN verified SET DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verified_at timestamp with time zone;
+UPDATE users SET verified_at = created_at WHERE verified AND verified_at IS NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_email ON users (email);
+-- Usernames are unique regardless of case, leaving out users who have not
+-- picked one yet
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username)) WHERE username <> '';
+CREATE INDEX IF NOT EXISTS idx_users_search_vector ON users USING GIN (search_vector);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_deleted_at ON password_resets (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_password_resets_token_hash ON password_resets (token_hash);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_deleted_at ON email_verifications (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_email_verifications_token_hash ON email_verifications (token_hash);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    user_agent text,
+    ip text,
+    last_seen_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_deleted_at ON sessions (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_sessions_token_hash ON sessions (token_hash);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    code_hash text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_deleted_at ON recovery_codes (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    scopes text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamp with time zone,
+    last_used_at timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_deleted_at ON api_tokens (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_api_tokens_token_hash ON api_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS experiences (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    company text NOT NULL,
+    role text NOT NULL,
+    start_date timestamp with time zone NOT NULL,
+    end_date timestamp with time zone,
+    description text,
+    position integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_experiences_deleted_at ON experiences (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_experiences_user_id ON experiences (user_id);
+
+CREATE TABLE IF NOT EXISTS educations (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    school text NOT NULL,
+    degree text,
+    field text,
+    start_date timestamp with time zone NOT NULL,
+    end_date timestamp with time zone,
+    description text,
+    position integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_educations_deleted_at ON educations (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_educations_user_id ON educations (user_id);
+
+CREATE TABLE IF NOT EXISTS projects (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    url text,
+    description text,
+    tech text,
+    position integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_projects_user_id ON projects (user_id);
+
+CREATE TABLE IF NOT EXISTS skills (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    name text NOT NULL,
+    slug text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_skills_deleted_at ON skills (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_skills_slug ON skills (slug);
+
+CREATE TABLE IF NOT EXISTS skill_aliases (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    alias text NOT NULL,
+    skill_id integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_skill_aliases_deleted_at ON skill_aliases (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_skill_aliases_skill_id ON skill_aliases (skill_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_skill_aliases_alias ON skill_aliases (alias);
+
+CREATE TABLE IF NOT EXISTS user_skills (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    skill_id integer NOT NULL,
+    level integer NOT NULL DEFAULT 0,
+    years integer NOT NULL DEFAULT 0,
+    position integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_user_skills_deleted_at ON user_skills (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_skill ON user_skills (user_id, skill_id);
+
+CREATE TABLE IF NOT EXISTS username_redirects (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    username text NOT NULL,
+    user_id integer NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_username_redirects_deleted_at ON username_redirects (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_username_redirects_user_id ON username_redirects (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_username_redirects_username ON username_redirects (username);
+
+CREATE TABLE IF NOT EXISTS profile_visibilities (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    email text NOT NULL,
+    title text NOT NULL,
+    summary text NOT NULL,
+    skills text NOT NULL,
+    experience text NOT NULL,
+    education text NOT NULL,
+    projects text NOT NULL,
+    share_token text
+);
+CREATE INDEX IF NOT EXISTS idx_profile_visibilities_deleted_at ON profile_visibilities (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_profile_visibilities_user_id ON profile_visibilities (user_id);
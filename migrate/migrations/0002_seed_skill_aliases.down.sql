@@ -0,0 +1,6 @@
+-- The skills stay, users may already have them
+DELETE FROM skill_aliases WHERE alias IN (
+    'golang', 'go lang', 'js', 'ecmascript', 'ts', 'py', 'python3',
+    'postgres', 'psql', 'k8s', 'reactjs', 'react.js', 'node', 'nodejs',
+    'vuejs', 'vue', 'c#', 'csharp', 'c++', 'cpp', 'aws', 'gcp', 'html5', 'css3'
+);
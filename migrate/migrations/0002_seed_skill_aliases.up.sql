@@ -0,0 +1,38 @@
+-- Common spellings of skills and the canonical skill they map to
+CREATE TEMPORARY TABLE default_skill_aliases (alias text, name text) ON COMMIT DROP;
+INSERT INTO default_skill_aliases (alias, name) VALUES
+    ('golang', 'Go'),
+    ('go lang', 'Go'),
+    ('js', 'JavaScript'),
+    ('ecmascript', 'JavaScript'),
+    ('ts', 'TypeScript'),
+    ('py', 'Python'),
+    ('python3', 'Python'),
+    ('postgres', 'PostgreSQL'),
+    ('psql', 'PostgreSQL'),
+    ('k8s', 'Kubernetes'),
+    ('reactjs', 'React'),
+    ('react.js', 'React'),
+    ('node', 'Node.js'),
+    ('nodejs', 'Node.js'),
+    ('vuejs', 'Vue.js'),
+    ('vue', 'Vue.js'),
+    ('c#', 'C#'),
+    ('csharp', 'C#'),
+    ('c++', 'C++'),
+    ('cpp', 'C++'),
+    ('aws', 'AWS'),
+    ('gcp', 'Google Cloud'),
+    ('html5', 'HTML'),
+    ('css3', 'CSS');
+
+INSERT INTO skills (created_at, updated_at, name, slug)
+SELECT DISTINCT now(), now(), name, LOWER(name)
+FROM default_skill_aliases
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO skill_aliases (created_at, updated_at, alias, skill_id)
+SELECT now(), now(), d.alias, s.id
+FROM default_skill_aliases d
+JOIN skills s ON s.slug = LOWER(d.name)
+ON CONFLICT (alias) DO NOTHING;
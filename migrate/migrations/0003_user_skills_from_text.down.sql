@@ -0,0 +1 @@
+-- Nothing to undo, users.skills still holds every skill as text
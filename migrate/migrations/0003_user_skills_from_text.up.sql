@@ -0,0 +1,44 @@
+-- Moves the comma separated users.skills of users who have no rows in
+-- user_skills yet over to the skills tables, the same way
+-- SkillService.SetUserSkills canonicalizes them
+CREATE TEMPORARY TABLE parsed_skills ON COMMIT DROP AS
+SELECT u.id AS user_id,
+    btrim(regexp_replace(s.name, '\s+', ' ', 'g')) AS name,
+    s.ord
+FROM users u
+CROSS JOIN LATERAL unnest(string_to_array(u.skills, ',')) WITH ORDINALITY AS s(name, ord)
+WHERE u.skills <> ''
+    AND btrim(regexp_replace(s.name, '\s+', ' ', 'g')) <> ''
+    AND NOT EXISTS (SELECT 1 FROM user_skills us WHERE us.user_id = u.id);
+
+-- Skills nobody has used before, spelled the way they were first written
+INSERT INTO skills (created_at, updated_at, name, slug)
+SELECT DISTINCT ON (LOWER(p.name)) now(), now(), p.name, LOWER(p.name)
+FROM parsed_skills p
+WHERE NOT EXISTS (SELECT 1 FROM skill_aliases a WHERE a.alias = LOWER(p.name) AND a.deleted_at IS NULL)
+ORDER BY LOWER(p.name), p.user_id, p.ord
+ON CONFLICT (slug) DO NOTHING;
+
+INSERT INTO user_skills (created_at, updated_at, user_id, skill_id, level, years, position)
+SELECT now(), now(), r.user_id, r.skill_id, 0, 0,
+    row_number() OVER (PARTITION BY r.user_id ORDER BY r.ord) - 1
+FROM (
+    SELECT DISTINCT ON (p.user_id, s.id) p.user_id, s.id AS skill_id, p.ord
+    FROM parsed_skills p
+    LEFT JOIN skill_aliases a ON a.alias = LOWER(p.name) AND a.deleted_at IS NULL
+    JOIN skills s ON s.id = COALESCE(a.skill_id,
+        (SELECT id FROM skills WHERE slug = LOWER(p.name) AND deleted_at IS NULL))
+    ORDER BY p.user_id, s.id, p.ord
+) r;
+
+-- users.skills is kept as a denormalized copy of the canonical names
+UPDATE users u SET skills = c.names
+FROM (
+    SELECT us.user_id, string_agg(s.name, ', ' ORDER BY us.position) AS names
+    FROM user_skills us
+    JOIN skills s ON s.id = us.skill_id
+    WHERE us.deleted_at IS NULL
+        AND us.user_id IN (SELECT user_id FROM parsed_skills)
+    GROUP BY us.user_id
+) c
+WHERE u.id = c.user_id;
@@ -0,0 +1 @@
+-- Nothing to undo, users are reindexed whenever they are saved
@@ -0,0 +1,14 @@
+-- Indexes users saved before search_vector existed, leaving out the
+-- fields they have not made public. Users without visibility settings get
+-- the defaults, where title, summary and skills are public
+UPDATE users u SET search_vector =
+    setweight(to_tsvector('simple', COALESCE(u.name, '') || ' ' || COALESCE(u.username, '')), 'A') ||
+    setweight(to_tsvector('simple', CASE WHEN COALESCE(v.title, 'public') = 'public'
+        THEN COALESCE(u.title, '') ELSE '' END), 'B') ||
+    setweight(to_tsvector('simple', CASE WHEN COALESCE(v.skills, 'public') = 'public'
+        THEN COALESCE(u.skills, '') ELSE '' END), 'C') ||
+    setweight(to_tsvector('simple', CASE WHEN COALESCE(v.summary, 'public') = 'public'
+        THEN COALESCE(u.summary, '') ELSE '' END), 'D')
+FROM users x
+LEFT JOIN profile_visibilities v ON v.user_id = x.id AND v.deleted_at IS NULL
+WHERE x.id = u.id AND u.search_vector IS NULL;
@@ -0,0 +1,25 @@
+CREATE TABLE throttles (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    key text NOT NULL,
+    failures integer NOT NULL,
+    last_failed_at timestamp with time zone NOT NULL,
+    blocked_until timestamp with time zone NOT NULL
+);
+CREATE INDEX idx_throttles_deleted_at ON throttles (deleted_at);
+CREATE UNIQUE INDEX uix_throttles_key ON throttles (key);
+
+CREATE TABLE account_unlocks (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+CREATE INDEX idx_account_unlocks_deleted_at ON account_unlocks (deleted_at);
+CREATE INDEX idx_account_unlocks_user_id ON account_unlocks (user_id);
+CREATE UNIQUE INDEX uix_account_unlocks_token_hash ON account_unlocks (token_hash);
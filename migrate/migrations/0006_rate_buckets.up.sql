@@ -0,0 +1,9 @@
+-- Token buckets of the rate limit middleware, shared by every instance.
+-- Rows are rewritten on every limited request, so the table is kept lean
+CREATE TABLE rate_buckets (
+    key text PRIMARY KEY,
+    tokens double precision NOT NULL,
+    allowed boolean NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+CREATE INDEX idx_rate_buckets_updated_at ON rate_buckets (updated_at);
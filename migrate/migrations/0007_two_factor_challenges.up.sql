@@ -0,0 +1,15 @@
+CREATE TABLE two_factor_challenges (
+    id serial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    failures integer NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_two_factor_challenges_deleted_at ON two_factor_challenges (deleted_at);
+CREATE INDEX idx_two_factor_challenges_user_id ON two_factor_challenges (user_id);
+CREATE UNIQUE INDEX uix_two_factor_challenges_token_hash ON two_factor_challenges (token_hash);
+
+ALTER TABLE users ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,342 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+const (
+	// ScopeProfileRead allows reading the token owner's profile
+	ScopeProfileRead = "profile:read"
+	// ScopeProfileWrite allows updating the token owner's profile
+	ScopeProfileWrite = "profile:write"
+
+	// APITokenPrefix is put in front of every token so they are easy to
+	// spot in config files and secret scanners
+	APITokenPrefix = "pat_"
+	// apiTokenTouchInterval limits how often last used is written to the db
+	apiTokenTouchInterval = time.Minute
+)
+
+// APITokenScopes lists every scope a token can be granted
+var APITokenScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+}
+
+// APIToken defines the shape of the api token db
+type APIToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"not null;index"`
+	Name       string `gorm:"not null"`
+	Scopes     string `gorm:"not null"`
+	Token      string `gorm:"-"`
+	TokenHash  string `gorm:"not null;unique_index"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// HasScope reports whether the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeList returns the scopes of the token as a slice
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// Expired reports whether the token is past its expiry
+func (t *APIToken) Expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// APITokenDB defines the shape of the api token db interface
+type APITokenDB interface {
+	Create(token *APIToken) error
+	ByToken(token string) (*APIToken, error)
+	ByUser(userID uint) ([]APIToken, error)
+	Update(token *APIToken) error
+	Delete(id uint) error
+}
+
+// APITokenService defines the shape of the api token service
+type APITokenService interface {
+	UserByToken(token string) (*User, *APIToken, error)
+	Revoke(userID, id uint) error
+	APITokenDB
+}
+
+type apiTokenService struct {
+	APITokenDB
+	us UserService
+}
+type apiTokenValidation struct {
+	APITokenDB
+	hmac hash.HMAC
+}
+type apiTokenGorm struct {
+	db *gorm.DB
+}
+
+// NewAPITokenService returns the api token service struct
+func NewAPITokenService(db *gorm.DB, us UserService, hmac hash.HMAC) APITokenService {
+	atg := newAPITokenGorm(db)
+	atv := newAPITokenValidation(atg, hmac)
+	return &apiTokenService{
+		APITokenDB: atv,
+		us:         us,
+	}
+}
+
+func newAPITokenValidation(atg *apiTokenGorm, hmac hash.HMAC) *apiTokenValidation {
+	return &apiTokenValidation{
+		hmac:       hmac,
+		APITokenDB: atg,
+	}
+}
+
+func newAPITokenGorm(db *gorm.DB) *apiTokenGorm {
+	return &apiTokenGorm{
+		db: db,
+	}
+}
+
+// ##################### API Token Service ################################ //
+
+// UserByToken resolves a bearer token to its user and records when the
+// token was last used
+func (ats *apiTokenService) UserByToken(token string) (*User, *APIToken, error) {
+	at, err := ats.APITokenDB.ByToken(token)
+	if err != nil {
+		return nil, nil, ErrTokenInvalid
+	}
+	if at.Expired() {
+		return nil, nil, ErrTokenInvalid
+	}
+	user, err := ats.us.ByID(at.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if at.LastUsedAt == nil || now.Sub(*at.LastUsedAt) > apiTokenTouchInterval {
+		at.LastUsedAt = &now
+		if err := ats.APITokenDB.Update(at); err != nil {
+			return nil, nil, err
+		}
+	}
+	return user, at, nil
+}
+
+// Revoke deletes one of the user's tokens
+func (ats *apiTokenService) Revoke(userID, id uint) error {
+	tokens, err := ats.APITokenDB.ByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		if t.ID == id {
+			return ats.APITokenDB.Delete(id)
+		}
+	}
+	return ErrNotFound
+}
+
+// ##################### API Token Validation ################################ //
+
+type apiTokenValFn func(token *APIToken) error
+
+func runAPITokenValFns(token *APIToken, fns ...apiTokenValFn) error {
+	for _, fn := range fns {
+		if err := fn(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (atv *apiTokenValidation) checkForUserID(token *APIToken) error {
+	if token.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (atv *apiTokenValidation) checkForName(token *APIToken) error {
+	token.Name = strings.TrimSpace(token.Name)
+	if token.Name == "" {
+		return ErrTokenNameMissing
+	}
+	return nil
+}
+
+func (atv *apiTokenValidation) normalizeScopes(token *APIToken) error {
+	var scopes []string
+	for _, s := range strings.Split(token.Scopes, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		valid := false
+		for _, known := range APITokenScopes {
+			if s == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return ErrScopeInvalid
+		}
+		scopes = append(scopes, s)
+	}
+	if len(scopes) == 0 {
+		return ErrScopeInvalid
+	}
+	token.Scopes = strings.Join(scopes, ",")
+	return nil
+}
+
+func (atv *apiTokenValidation) checkExpiry(token *APIToken) error {
+	if token.Expired() {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (atv *apiTokenValidation) generateToken(token *APIToken) error {
+	if token.Token != "" {
+		return nil
+	}
+	t, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	token.Token = APITokenPrefix + t
+	return nil
+}
+
+func (atv *apiTokenValidation) tokenHash(token *APIToken) error {
+	if token.Token == "" {
+		return ErrTokenInvalid
+	}
+	token.TokenHash = atv.hmac.Hash(token.Token)
+	return nil
+}
+
+func (atv *apiTokenValidation) checkForTokenHash(token *APIToken) error {
+	if token.TokenHash == "" {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func (atv *apiTokenValidation) Create(token *APIToken) error {
+	if err := runAPITokenValFns(token,
+		atv.checkForUserID,
+		atv.checkForName,
+		atv.normalizeScopes,
+		atv.checkExpiry,
+		atv.generateToken,
+		atv.tokenHash,
+	); err != nil {
+		return err
+	}
+	return atv.APITokenDB.Create(token)
+}
+
+func (atv *apiTokenValidation) ByToken(token string) (*APIToken, error) {
+	at := &APIToken{
+		Token: token,
+	}
+	if err := runAPITokenValFns(at, atv.tokenHash); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range atv.hmac.Hashes(at.Token) {
+		var found *APIToken
+		if found, err = atv.APITokenDB.ByToken(tokenHash); err != nil {
+			continue
+		}
+		// Move tokens hashed with an old key onto the active one, so they
+		// outlive the key's grace period
+		if found.TokenHash != at.TokenHash {
+			found.TokenHash = at.TokenHash
+			if err := atv.APITokenDB.Update(found); err != nil {
+				return nil, err
+			}
+		}
+		return found, nil
+	}
+	return nil, err
+}
+
+func (atv *apiTokenValidation) ByUser(userID uint) ([]APIToken, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return atv.APITokenDB.ByUser(userID)
+}
+
+func (atv *apiTokenValidation) Update(token *APIToken) error {
+	if err := runAPITokenValFns(token,
+		atv.checkForUserID,
+		atv.checkForName,
+		atv.normalizeScopes,
+		atv.checkForTokenHash,
+	); err != nil {
+		return err
+	}
+	return atv.APITokenDB.Update(token)
+}
+
+func (atv *apiTokenValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return atv.APITokenDB.Delete(id)
+}
+
+// ##################### API Token Gorm ################################ //
+
+func (atg *apiTokenGorm) Create(token *APIToken) error {
+	return atg.db.Create(token).Error
+}
+
+// ByToken expects the already hashed token
+func (atg *apiTokenGorm) ByToken(tokenHash string) (*APIToken, error) {
+	var token APIToken
+	if err := atg.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (atg *apiTokenGorm) ByUser(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	if err := atg.db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (atg *apiTokenGorm) Update(token *APIToken) error {
+	return atg.db.Save(token).Error
+}
+
+func (atg *apiTokenGorm) Delete(id uint) error {
+	token := APIToken{Model: gorm.Model{ID: id}}
+	return atg.db.Unscoped().Delete(&token).Error
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"profile.com/avatar"
+	"profile.com/storage"
+)
+
+// avatarPrefix is the storage key prefix every avatar lives under
+const avatarPrefix = "avatars"
+
+// AvatarURL returns the path of the smallest avatar variant at least
+// size pixels wide, or of the user's identicon when they have not uploaded
+// a picture
+func (u *User) AvatarURL(size int) string {
+	if u.Avatar == "" {
+		return fmt.Sprintf("/avatar/%d.svg", u.ID)
+	}
+	return "/" + avatarKey(u.ID, u.Avatar, avatarVariant(size))
+}
+
+// avatarVariant picks the variant to serve for size
+func avatarVariant(size int) int {
+	for _, s := range avatar.Sizes {
+		if s >= size {
+			return s
+		}
+	}
+	return avatar.Sizes[len(avatar.Sizes)-1]
+}
+
+// avatarKey is the storage key of one variant, name being the content
+// hash and extension kept on the user
+func avatarKey(userID uint, name string, size int) string {
+	ext := ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name, ext = name[:i], name[i:]
+	}
+	return fmt.Sprintf("%s/%d/%s-%d%s", avatarPrefix, userID, name, size, ext)
+}
+
+// AvatarService stores the pictures users upload
+type AvatarService interface {
+	// Upload processes the image in r and makes it the user's avatar
+	Upload(user *User, r io.Reader) error
+	// Remove deletes the user's avatar
+	Remove(user *User) error
+	// Open reads a stored avatar variant by its key
+	Open(key string) (io.ReadCloser, *storage.Info, error)
+}
+
+type avatarService struct {
+	us   UserService
+	blob storage.Blob
+}
+
+// NewAvatarService returns the avatar service struct storing images in blob
+func NewAvatarService(us UserService, blob storage.Blob) AvatarService {
+	return &avatarService{
+		us:   us,
+		blob: blob,
+	}
+}
+
+func (as *avatarService) Upload(user *User, r io.Reader) error {
+	processed, err := avatar.Process(r)
+	switch err {
+	case nil:
+	case avatar.ErrTooLarge:
+		return ErrAvatarTooLarge
+	case avatar.ErrUnsupported:
+		return ErrAvatarType
+	default:
+		return err
+	}
+
+	// name the upload after its content so every variant can be cached
+	// forever, a new upload gets a new URL
+	sum := sha256.Sum256(processed.Variants[avatar.Sizes[len(avatar.Sizes)-1]])
+	name := hex.EncodeToString(sum[:8]) + processed.Ext
+	for _, size := range avatar.Sizes {
+		key := avatarKey(user.ID, name, size)
+		if err := as.blob.Put(key, bytes.NewReader(processed.Variants[size]), processed.ContentType); err != nil {
+			return err
+		}
+	}
+
+	old := user.Avatar
+	user.Avatar = name
+	if err := as.us.Update(user); err != nil {
+		user.Avatar = old
+		return err
+	}
+	if old != "" && old != name {
+		as.deleteVariants(user.ID, old)
+	}
+	return nil
+}
+
+func (as *avatarService) Remove(user *User) error {
+	old := user.Avatar
+	if old == "" {
+		return nil
+	}
+	user.Avatar = ""
+	if err := as.us.Update(user); err != nil {
+		user.Avatar = old
+		return err
+	}
+	as.deleteVariants(user.ID, old)
+	return nil
+}
+
+func (as *avatarService) Open(key string) (io.ReadCloser, *storage.Info, error) {
+	if !strings.HasPrefix(key, avatarPrefix+"/") {
+		return nil, nil, storage.ErrNotFound
+	}
+	return as.blob.Get(key)
+}
+
+// deleteVariants removes an avatar that is no longer used. Failing to
+// only leaves files behind, so it does not fail the request
+func (as *avatarService) deleteVariants(userID uint, name string) {
+	for _, size := range avatar.Sizes {
+		as.blob.Delete(avatarKey(userID, name, size))
+	}
+}
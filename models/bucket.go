@@ -0,0 +1,189 @@
+package models
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RateLimit is a token bucket that holds up to Burst requests and refills
+// at Requests every Per. Burst defaults to Requests
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// burst returns how many requests the full bucket holds
+func (rl RateLimit) burst() float64 {
+	if rl.Burst > 0 {
+		return float64(rl.Burst)
+	}
+	return float64(rl.Requests)
+}
+
+// rate returns how many tokens are added every second
+func (rl RateLimit) rate() float64 {
+	return float64(rl.Requests) / rl.Per.Seconds()
+}
+
+// Bucket is the state of a token bucket after taking from it
+type Bucket struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next request is allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// newBucket describes a bucket holding tokens under limit
+func newBucket(limit RateLimit, tokens float64, allowed bool) *Bucket {
+	b := &Bucket{
+		Allowed:   allowed,
+		Limit:     int(limit.burst()),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsDuration((limit.burst() - tokens) / limit.rate()),
+	}
+	if tokens < 1 {
+		b.RetryAfter = secondsDuration((1 - tokens) / limit.rate())
+	}
+	return b
+}
+
+// secondsDuration converts fractional seconds to a duration
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// BucketStore keeps the token buckets of the rate limit middleware
+type BucketStore interface {
+	// Take refills the bucket of key for the time that passed and takes a
+	// token from it if there is one
+	Take(key string, limit RateLimit) (*Bucket, error)
+}
+
+// ##################### Memory Bucket Store ################################ //
+
+// MemoryBucketStore keeps buckets in memory, so limits only hold within
+// one instance
+type MemoryBucketStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+const (
+	// bucketSweepInterval is how often idle buckets are dropped
+	bucketSweepInterval = 10 * time.Minute
+	// bucketIdleExpiry is how long a shared bucket is kept after its last
+	// request. Limits must refill faster than this
+	bucketIdleExpiry = 24 * time.Hour
+)
+
+// NewMemoryBucketStore returns an empty in-memory bucket store
+func NewMemoryBucketStore() *MemoryBucketStore {
+	return &MemoryBucketStore{
+		buckets:   map[string]*memoryBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Take takes a token from the bucket of key
+func (ms *MemoryBucketStore) Take(key string, limit RateLimit) (*Bucket, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	ms.sweep(now)
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: limit.burst(), updated: now}
+		ms.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.burst(), b.tokens+now.Sub(b.updated).Seconds()*limit.rate())
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	bucket := newBucket(limit, b.tokens, allowed)
+	b.full = now.Add(bucket.Reset)
+	return bucket, nil
+}
+
+// sweep drops the buckets that have filled up again, since a missing
+// bucket starts out full anyway
+func (ms *MemoryBucketStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < bucketSweepInterval {
+		return
+	}
+	ms.lastSweep = now
+	for key, b := range ms.buckets {
+		if now.After(b.full) {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+// ##################### Postgres Bucket Store ################################ //
+
+type bucketGorm struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresBucketStore returns a bucket store backed by the rate_buckets
+// table, so limits hold across every instance of the app
+func NewPostgresBucketStore(db *gorm.DB) BucketStore {
+	return &bucketGorm{
+		db:        db,
+		lastSweep: time.Now(),
+	}
+}
+
+// Take refills and takes from the bucket in one upsert, so concurrent
+// requests on different instances cannot both take the last token
+func (bg *bucketGorm) Take(key string, limit RateLimit) (*Bucket, error) {
+	now := time.Now()
+	bg.sweep(now)
+	burst, rate := limit.burst(), limit.rate()
+	refilled := "LEAST(?, rate_buckets.tokens + EXTRACT(EPOCH FROM (?::timestamptz - rate_buckets.updated_at)) * ?)"
+	var tokens float64
+	var allowed bool
+	err := bg.db.Raw("INSERT INTO rate_buckets (key, tokens, allowed, updated_at) "+
+		"VALUES (?, ?, true, ?) "+
+		"ON CONFLICT (key) DO UPDATE SET "+
+		"tokens = CASE WHEN "+refilled+" >= 1 THEN "+refilled+" - 1 ELSE "+refilled+" END, "+
+		"allowed = "+refilled+" >= 1, "+
+		"updated_at = EXCLUDED.updated_at "+
+		"RETURNING tokens, allowed",
+		key, burst-1, now,
+		burst, now, rate, burst, now, rate, burst, now, rate, burst, now, rate).
+		Row().Scan(&tokens, &allowed)
+	if err != nil {
+		return nil, err
+	}
+	return newBucket(limit, tokens, allowed), nil
+}
+
+// sweep deletes the buckets nobody has used for bucketIdleExpiry, at most
+// once per interval on each instance
+func (bg *bucketGorm) sweep(now time.Time) {
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+	if now.Sub(bg.lastSweep) < bucketSweepInterval {
+		return
+	}
+	bg.lastSweep = now
+	bg.db.Exec("DELETE FROM rate_buckets WHERE updated_at < ?", now.Add(-bucketIdleExpiry))
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+// twoFactorChallengeMaxFailures is how many wrong codes a pending login
+// takes before the user has to give their password again
+const twoFactorChallengeMaxFailures = 3
+
+// TwoFactorChallenge defines the shape of the two factor challenge db, a
+// login waiting for its second factor after the password step passed
+type TwoFactorChallenge struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	Token     string    `gorm:"-"`
+	TokenHash string    `gorm:"not null;unique_index"`
+	ExpiresAt time.Time `gorm:"not null"`
+	Failures  int       `gorm:"not null;default:0"`
+}
+
+// TwoFactorChallengeDB defines the shape of the two factor challenge db interface
+type TwoFactorChallengeDB interface {
+	Create(tfc *TwoFactorChallenge) error
+	ByToken(token string) (*TwoFactorChallenge, error)
+	// Fail counts a wrong code against the challenge and returns the
+	// failures so far
+	Fail(id uint) (int, error)
+	DeleteByUser(userID uint) error
+}
+
+type twoFactorChallengeValidation struct {
+	TwoFactorChallengeDB
+	hmac hash.HMAC
+}
+type twoFactorChallengeGorm struct {
+	db *gorm.DB
+}
+
+func newTwoFactorChallengeValidation(tfcg *twoFactorChallengeGorm, hmac hash.HMAC) *twoFactorChallengeValidation {
+	return &twoFactorChallengeValidation{
+		hmac:                 hmac,
+		TwoFactorChallengeDB: tfcg,
+	}
+}
+
+func newTwoFactorChallengeGorm(db *gorm.DB) *twoFactorChallengeGorm {
+	return &twoFactorChallengeGorm{
+		db: db,
+	}
+}
+
+// ##################### Two Factor Challenge Validation ################################ //
+
+type twoFactorChallengeValFn func(tfc *TwoFactorChallenge) error
+
+func runTwoFactorChallengeValFns(tfc *TwoFactorChallenge, fns ...twoFactorChallengeValFn) error {
+	for _, fn := range fns {
+		if err := fn(tfc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tfcv *twoFactorChallengeValidation) checkForUserID(tfc *TwoFactorChallenge) error {
+	if tfc.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (tfcv *twoFactorChallengeValidation) generateToken(tfc *TwoFactorChallenge) error {
+	if tfc.Token != "" {
+		return nil
+	}
+	token, err := rand.String(rand.RememberTokenBytes)
+	if err != nil {
+		return err
+	}
+	tfc.Token = token
+	return nil
+}
+
+func (tfcv *twoFactorChallengeValidation) tokenHash(tfc *TwoFactorChallenge) error {
+	if tfc.Token == "" {
+		return ErrTokenInvalid
+	}
+	tfc.TokenHash = tfcv.hmac.Hash(tfc.Token)
+	return nil
+}
+
+func (tfcv *twoFactorChallengeValidation) setExpiry(tfc *TwoFactorChallenge) error {
+	if tfc.ExpiresAt.IsZero() {
+		tfc.ExpiresAt = time.Now().Add(TwoFactorPendingExpiry)
+	}
+	return nil
+}
+
+func (tfcv *twoFactorChallengeValidation) Create(tfc *TwoFactorChallenge) error {
+	if err := runTwoFactorChallengeValFns(tfc,
+		tfcv.checkForUserID,
+		tfcv.generateToken,
+		tfcv.tokenHash,
+		tfcv.setExpiry,
+	); err != nil {
+		return err
+	}
+	return tfcv.TwoFactorChallengeDB.Create(tfc)
+}
+
+func (tfcv *twoFactorChallengeValidation) ByToken(token string) (*TwoFactorChallenge, error) {
+	tfc := &TwoFactorChallenge{
+		Token: token,
+	}
+	if err := runTwoFactorChallengeValFns(tfc, tfcv.tokenHash); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range tfcv.hmac.Hashes(tfc.Token) {
+		var found *TwoFactorChallenge
+		if found, err = tfcv.TwoFactorChallengeDB.ByToken(tokenHash); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (tfcv *twoFactorChallengeValidation) Fail(id uint) (int, error) {
+	if id == 0 {
+		return 0, ErrIDInvalid
+	}
+	return tfcv.TwoFactorChallengeDB.Fail(id)
+}
+
+func (tfcv *twoFactorChallengeValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return tfcv.TwoFactorChallengeDB.DeleteByUser(userID)
+}
+
+// ##################### Two Factor Challenge Gorm ################################ //
+
+func (tfcg *twoFactorChallengeGorm) Create(tfc *TwoFactorChallenge) error {
+	return tfcg.db.Create(tfc).Error
+}
+
+// ByToken expects the already hashed token
+func (tfcg *twoFactorChallengeGorm) ByToken(tokenHash string) (*TwoFactorChallenge, error) {
+	var tfc TwoFactorChallenge
+	if err := tfcg.db.Where("token_hash = ?", tokenHash).First(&tfc).Error; err != nil {
+		return nil, err
+	}
+	return &tfc, nil
+}
+
+// Fail counts the failure in a single statement, so parallel guesses on
+// the same challenge are all counted
+func (tfcg *twoFactorChallengeGorm) Fail(id uint) (int, error) {
+	var failures int
+	err := tfcg.db.Raw("UPDATE two_factor_challenges SET failures = failures + 1, updated_at = ? "+
+		"WHERE id = ? RETURNING failures", time.Now(), id).Row().Scan(&failures)
+	return failures, err
+}
+
+func (tfcg *twoFactorChallengeGorm) DeleteByUser(userID uint) error {
+	return tfcg.db.Unscoped().Where("user_id = ?", userID).Delete(TwoFactorChallenge{}).Error
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const educationsTable = "educations"
+
+// Education defines the shape of the education db
+type Education struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;index"`
+	School      string `gorm:"not null"`
+	Degree      string
+	Field       string
+	StartDate   time.Time `gorm:"not null"`
+	EndDate     *time.Time
+	Description string
+	Position    int `gorm:"not null"`
+}
+
+// EducationDB defines the shape of the education db interface
+type EducationDB interface {
+	ByID(id uint) (*Education, error)
+	ByUser(userID uint) ([]Education, error)
+	Create(education *Education) error
+	Update(education *Education) error
+	Delete(id uint) error
+	Move(education *Education, up bool) error
+}
+
+// EducationService defines the shape of the education service
+type EducationService interface {
+	EducationDB
+}
+
+type educationService struct {
+	EducationDB
+}
+type educationValidation struct {
+	EducationDB
+}
+type educationGorm struct {
+	db *gorm.DB
+}
+
+// NewEducationService returns the education service struct
+func NewEducationService(db *gorm.DB) EducationService {
+	edg := newEducationGorm(db)
+	edv := newEducationValidation(edg)
+	return &educationService{
+		EducationDB: edv,
+	}
+}
+
+func newEducationValidation(edg *educationGorm) *educationValidation {
+	return &educationValidation{
+		EducationDB: edg,
+	}
+}
+
+func newEducationGorm(db *gorm.DB) *educationGorm {
+	return &educationGorm{
+		db: db,
+	}
+}
+
+// ##################### Education Validation ################################ //
+
+type educationValFn func(education *Education) error
+
+func runEducationValFns(education *Education, fns ...educationValFn) error {
+	for _, fn := range fns {
+		if err := fn(education); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ev *educationValidation) checkForUserID(education *Education) error {
+	if education.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (ev *educationValidation) trimFields(education *Education) error {
+	education.School = strings.TrimSpace(education.School)
+	education.Degree = strings.TrimSpace(education.Degree)
+	education.Field = strings.TrimSpace(education.Field)
+	education.Description = strings.TrimSpace(education.Description)
+	return nil
+}
+
+func (ev *educationValidation) checkForSchool(education *Education) error {
+	if education.School == "" {
+		return ErrSchoolMissing
+	}
+	return nil
+}
+
+func (ev *educationValidation) checkDates(education *Education) error {
+	return checkDateRange(education.StartDate, education.EndDate)
+}
+
+func (ev *educationValidation) ByID(id uint) (*Education, error) {
+	if id == 0 {
+		return nil, ErrIDInvalid
+	}
+	return ev.EducationDB.ByID(id)
+}
+
+func (ev *educationValidation) ByUser(userID uint) ([]Education, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return ev.EducationDB.ByUser(userID)
+}
+
+func (ev *educationValidation) Create(education *Education) error {
+	if err := runEducationValFns(education,
+		ev.checkForUserID,
+		ev.trimFields,
+		ev.checkForSchool,
+		ev.checkDates,
+	); err != nil {
+		return err
+	}
+	return ev.EducationDB.Create(education)
+}
+
+func (ev *educationValidation) Update(education *Education) error {
+	if err := runEducationValFns(education,
+		ev.checkForUserID,
+		ev.trimFields,
+		ev.checkForSchool,
+		ev.checkDates,
+	); err != nil {
+		return err
+	}
+	return ev.EducationDB.Update(education)
+}
+
+func (ev *educationValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return ev.EducationDB.Delete(id)
+}
+
+// ##################### Education Gorm ################################ //
+
+func (eg *educationGorm) ByID(id uint) (*Education, error) {
+	var education Education
+	if err := eg.db.Where("id = ?", id).First(&education).Error; err != nil {
+		return nil, err
+	}
+	return &education, nil
+}
+
+func (eg *educationGorm) ByUser(userID uint) ([]Education, error) {
+	var educations []Education
+	if err := eg.db.Where("user_id = ?", userID).Order("position asc").Find(&educations).Error; err != nil {
+		return nil, err
+	}
+	return educations, nil
+}
+
+func (eg *educationGorm) Create(education *Education) error {
+	position, err := nextPosition(eg.db, educationsTable, education.UserID)
+	if err != nil {
+		return err
+	}
+	education.Position = position
+	return eg.db.Create(education).Error
+}
+
+func (eg *educationGorm) Update(education *Education) error {
+	return eg.db.Save(education).Error
+}
+
+func (eg *educationGorm) Delete(id uint) error {
+	education := Education{Model: gorm.Model{ID: id}}
+	return eg.db.Unscoped().Delete(&education).Error
+}
+
+func (eg *educationGorm) Move(education *Education, up bool) error {
+	return movePosition(eg.db, educationsTable, education.UserID, education.ID, education.Position, up)
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const experiencesTable = "experiences"
+
+// Experience defines the shape of the work experience db
+type Experience struct {
+	gorm.Model
+	UserID      uint      `gorm:"not null;index"`
+	Company     string    `gorm:"not null"`
+	Role        string    `gorm:"not null"`
+	StartDate   time.Time `gorm:"not null"`
+	EndDate     *time.Time
+	Description string
+	Position    int `gorm:"not null"`
+}
+
+// ExperienceDB defines the shape of the experience db interface
+type ExperienceDB interface {
+	ByID(id uint) (*Experience, error)
+	ByUser(userID uint) ([]Experience, error)
+	Create(experience *Experience) error
+	Update(experience *Experience) error
+	Delete(id uint) error
+	Move(experience *Experience, up bool) error
+}
+
+// ExperienceService defines the shape of the experience service
+type ExperienceService interface {
+	ExperienceDB
+}
+
+type experienceService struct {
+	ExperienceDB
+}
+type experienceValidation struct {
+	ExperienceDB
+}
+type experienceGorm struct {
+	db *gorm.DB
+}
+
+// NewExperienceService returns the experience service struct
+func NewExperienceService(db *gorm.DB) ExperienceService {
+	eg := newExperienceGorm(db)
+	ev := newExperienceValidation(eg)
+	return &experienceService{
+		ExperienceDB: ev,
+	}
+}
+
+func newExperienceValidation(eg *experienceGorm) *experienceValidation {
+	return &experienceValidation{
+		ExperienceDB: eg,
+	}
+}
+
+func newExperienceGorm(db *gorm.DB) *experienceGorm {
+	return &experienceGorm{
+		db: db,
+	}
+}
+
+// ##################### Experience Validation ################################ //
+
+type experienceValFn func(experience *Experience) error
+
+func runExperienceValFns(experience *Experience, fns ...experienceValFn) error {
+	for _, fn := range fns {
+		if err := fn(experience); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ev *experienceValidation) checkForUserID(experience *Experience) error {
+	if experience.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (ev *experienceValidation) trimFields(experience *Experience) error {
+	experience.Company = strings.TrimSpace(experience.Company)
+	experience.Role = strings.TrimSpace(experience.Role)
+	experience.Description = strings.TrimSpace(experience.Description)
+	return nil
+}
+
+func (ev *experienceValidation) checkForCompany(experience *Experience) error {
+	if experience.Company == "" {
+		return ErrCompanyMissing
+	}
+	return nil
+}
+
+func (ev *experienceValidation) checkForRole(experience *Experience) error {
+	if experience.Role == "" {
+		return ErrRoleMissing
+	}
+	return nil
+}
+
+func (ev *experienceValidation) checkDates(experience *Experience) error {
+	return checkDateRange(experience.StartDate, experience.EndDate)
+}
+
+func (ev *experienceValidation) ByID(id uint) (*Experience, error) {
+	if id == 0 {
+		return nil, ErrIDInvalid
+	}
+	return ev.ExperienceDB.ByID(id)
+}
+
+func (ev *experienceValidation) ByUser(userID uint) ([]Experience, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return ev.ExperienceDB.ByUser(userID)
+}
+
+func (ev *experienceValidation) Create(experience *Experience) error {
+	if err := runExperienceValFns(experience,
+		ev.checkForUserID,
+		ev.trimFields,
+		ev.checkForCompany,
+		ev.checkForRole,
+		ev.checkDates,
+	); err != nil {
+		return err
+	}
+	return ev.ExperienceDB.Create(experience)
+}
+
+func (ev *experienceValidation) Update(experience *Experience) error {
+	if err := runExperienceValFns(experience,
+		ev.checkForUserID,
+		ev.trimFields,
+		ev.checkForCompany,
+		ev.checkForRole,
+		ev.checkDates,
+	); err != nil {
+		return err
+	}
+	return ev.ExperienceDB.Update(experience)
+}
+
+func (ev *experienceValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return ev.ExperienceDB.Delete(id)
+}
+
+// ##################### Experience Gorm ################################ //
+
+func (eg *experienceGorm) ByID(id uint) (*Experience, error) {
+	var experience Experience
+	if err := eg.db.Where("id = ?", id).First(&experience).Error; err != nil {
+		return nil, err
+	}
+	return &experience, nil
+}
+
+func (eg *experienceGorm) ByUser(userID uint) ([]Experience, error) {
+	var experiences []Experience
+	if err := eg.db.Where("user_id = ?", userID).Order("position asc").Find(&experiences).Error; err != nil {
+		return nil, err
+	}
+	return experiences, nil
+}
+
+func (eg *experienceGorm) Create(experience *Experience) error {
+	position, err := nextPosition(eg.db, experiencesTable, experience.UserID)
+	if err != nil {
+		return err
+	}
+	experience.Position = position
+	return eg.db.Create(experience).Error
+}
+
+func (eg *experienceGorm) Update(experience *Experience) error {
+	return eg.db.Save(experience).Error
+}
+
+func (eg *experienceGorm) Delete(id uint) error {
+	experience := Experience{Model: gorm.Model{ID: id}}
+	return eg.db.Unscoped().Delete(&experience).Error
+}
+
+func (eg *experienceGorm) Move(experience *Experience, up bool) error {
+	return movePosition(eg.db, experiencesTable, experience.UserID, experience.ID, experience.Position, up)
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+)
+
+var (
+	// AccountBackoff throttles password guesses against one email address,
+	// locking it after ten failures in a row
+	AccountBackoff = Backoff{
+		Free:      3,
+		Base:      time.Second,
+		Max:       5 * time.Minute,
+		LockAfter: 10,
+		Lockout:   time.Hour,
+		Window:    24 * time.Hour,
+	}
+	// IPBackoff throttles guesses from one IP across every account, it is
+	// looser since many users can share an address
+	IPBackoff = Backoff{
+		Free:   20,
+		Base:   time.Second,
+		Max:    15 * time.Minute,
+		Window: time.Hour,
+	}
+)
+
+// Lockout is returned by LoginService.Authenticate when the attempt locked
+// the account. Token unlocks it and is meant to be emailed to User
+type Lockout struct {
+	User  *User
+	Token string
+}
+
+func (l *Lockout) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+// LoginService guards UserService.Authenticate with per account and per
+// IP backoff and the account lockout
+type LoginService interface {
+	Authenticate(user *User, ip string) (*User, error)
+	Unlock(token string) (*User, error)
+}
+
+type loginService struct {
+	AccountUnlockDB
+	us        UserService
+	accounts  RateLimiter
+	ips       RateLimiter
+	lockAfter int
+}
+
+// NewLoginService returns the login service struct, newLimiter builds the
+// rate limiters for the account and IP backoffs
+func NewLoginService(db *gorm.DB, us UserService, newLimiter func(Backoff) RateLimiter, hmac hash.HMAC) LoginService {
+	aug := newAccountUnlockGorm(db)
+	auv := newAccountUnlockValidation(aug, hmac)
+	return &loginService{
+		AccountUnlockDB: auv,
+		us:              us,
+		accounts:        newLimiter(AccountBackoff),
+		ips:             newLimiter(IPBackoff),
+		lockAfter:       AccountBackoff.LockAfter,
+	}
+}
+
+// accountKey is the rate limiter key of an email address. Emails without
+// an account are throttled too, so the replies do not give away which
+// addresses are signed up
+func accountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// Authenticate checks the credentials unless the account or IP has to
+// wait. The attempt is counted before the password is checked and taken
+// back on success, so parallel guesses cannot all get in before the
+// first failure is recorded. Wrong emails and passwords get the same
+// error, and the failure that locks an existing account returns a *Lockout
+func (ls *loginService) Authenticate(user *User, ip string) (*User, error) {
+	account := accountKey(user.Email)
+	ipKey := "ip:" + ip
+	wait, _, err := ls.ips.Attempt(ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, ErrTooManyAttempts
+	}
+	wait, failures, err := ls.accounts.Attempt(account)
+	if err == nil && wait > 0 {
+		err = ErrTooManyAttempts
+	}
+	if err != nil {
+		// Refunds are best effort, at worst the key waits a little longer
+		ls.ips.Refund(ipKey)
+		return nil, err
+	}
+
+	found, err := ls.us.Authenticate(user)
+	switch err {
+	case nil:
+		ls.ips.Refund(ipKey)
+		return found, ls.accounts.Reset(account)
+	case ErrInvalidCredentials:
+	default:
+		ls.ips.Refund(ipKey)
+		ls.accounts.Refund(account)
+		return nil, err
+	}
+	if failures != ls.lockAfter {
+		return nil, ErrInvalidCredentials
+	}
+	locked, err := ls.us.ByEmail(user.Email)
+	if err != nil {
+		return nil, ErrTooManyAttempts
+	}
+	unlock, err := ls.initiateUnlock(locked)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &Lockout{
+		User:  locked,
+		Token: unlock.Token,
+	}
+}
+
+// Unlock lifts the lockout of the owner of the token
+func (ls *loginService) Unlock(token string) (*User, error) {
+	au, err := ls.AccountUnlockDB.ByToken(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().After(au.ExpiresAt) {
+		ls.AccountUnlockDB.DeleteByUser(au.UserID)
+		return nil, ErrTokenInvalid
+	}
+	user, err := ls.us.ByID(au.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ls.accounts.Reset(accountKey(user.Email)); err != nil {
+		return nil, err
+	}
+	if err := ls.AccountUnlockDB.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// initiateUnlock issues a new unlock token, replacing any sent before
+func (ls *loginService) initiateUnlock(user *User) (*AccountUnlock, error) {
+	if err := ls.AccountUnlockDB.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	au := AccountUnlock{
+		UserID: user.ID,
+	}
+	if err := ls.AccountUnlockDB.Create(&au); err != nil {
+		return nil, err
+	}
+	return &au, nil
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+// PasswordResetExpiry is how long a password reset token stays valid
+const PasswordResetExpiry = 1 * time.Hour
+
+// PasswordReset defines the shape of the password reset db
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	Token     string    `gorm:"-"`
+	TokenHash string    `gorm:"not null;unique_index"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// PasswordResetDB defines the shape of the password reset db interface
+type PasswordResetDB interface {
+	Create(pwr *PasswordReset) error
+	ByToken(token string) (*PasswordReset, error)
+	Delete(id uint) error
+	DeleteByUser(userID uint) error
+}
+
+// PasswordResetService defines the shape of the password reset service
+type PasswordResetService interface {
+	Initiate(email string) (string, error)
+	Complete(token, password string) (*User, error)
+}
+
+type passwordResetService struct {
+	PasswordResetDB
+	us UserService
+}
+type passwordResetValidation struct {
+	PasswordResetDB
+	hmac hash.HMAC
+}
+type passwordResetGorm struct {
+	db *gorm.DB
+}
+
+// NewPasswordResetService returns the password reset service struct
+func NewPasswordResetService(db *gorm.DB, us UserService, hmac hash.HMAC) PasswordResetService {
+	pwrg := newPasswordResetGorm(db)
+	pwrv := newPasswordResetValidation(pwrg, hmac)
+	return &passwordResetService{
+		PasswordResetDB: pwrv,
+		us:              us,
+	}
+}
+
+func newPasswordResetValidation(pwrg *passwordResetGorm, hmac hash.HMAC) *passwordResetValidation {
+	return &passwordResetValidation{
+		hmac:            hmac,
+		PasswordResetDB: pwrg,
+	}
+}
+
+func newPasswordResetGorm(db *gorm.DB) *passwordResetGorm {
+	return &passwordResetGorm{
+		db: db,
+	}
+}
+
+// ##################### Password Reset Service ################################ //
+
+// Initiate issues a new reset token for the user with the given email
+func (prs *passwordResetService) Initiate(email string) (string, error) {
+	user, err := prs.us.ByEmail(email)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	pwr := PasswordReset{
+		UserID: user.ID,
+	}
+	if err := prs.PasswordResetDB.Create(&pwr); err != nil {
+		return "", err
+	}
+	return pwr.Token, nil
+}
+
+// Complete sets a new password for the owner of the token and deletes
+// every reset token of the user so none can be used again. An empty
+// password is refused before the token is touched, since Update would
+// keep the old password and the reset would sign the user in for free
+func (prs *passwordResetService) Complete(token, password string) (*User, error) {
+	if password == "" {
+		return nil, ErrPasswordNotProvided
+	}
+	pwr, err := prs.PasswordResetDB.ByToken(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().After(pwr.ExpiresAt) {
+		prs.PasswordResetDB.Delete(pwr.ID)
+		return nil, ErrTokenInvalid
+	}
+	user, err := prs.us.ByID(pwr.UserID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = password
+	if err := prs.us.Update(user); err != nil {
+		return nil, err
+	}
+	if err := prs.PasswordResetDB.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ##################### Password Reset Validation ################################ //
+
+type pwResetValFn func(pwr *PasswordReset) error
+
+func runPwResetValFns(pwr *PasswordReset, fns ...pwResetValFn) error {
+	for _, fn := range fns {
+		if err := fn(pwr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pwrv *passwordResetValidation) checkForUserID(pwr *PasswordReset) error {
+	if pwr.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (pwrv *passwordResetValidation) generateToken(pwr *PasswordReset) error {
+	if pwr.Token != "" {
+		return nil
+	}
+	token, err := rand.String(rand.RememberTokenBytes)
+	if err != nil {
+		return err
+	}
+	pwr.Token = token
+	return nil
+}
+
+func (pwrv *passwordResetValidation) tokenHash(pwr *PasswordReset) error {
+	if pwr.Token == "" {
+		return ErrTokenInvalid
+	}
+	pwr.TokenHash = pwrv.hmac.Hash(pwr.Token)
+	return nil
+}
+
+func (pwrv *passwordResetValidation) setExpiry(pwr *PasswordReset) error {
+	if pwr.ExpiresAt.IsZero() {
+		pwr.ExpiresAt = time.Now().Add(PasswordResetExpiry)
+	}
+	return nil
+}
+
+func (pwrv *passwordResetValidation) Create(pwr *PasswordReset) error {
+	if err := runPwResetValFns(pwr,
+		pwrv.checkForUserID,
+		pwrv.generateToken,
+		pwrv.tokenHash,
+		pwrv.setExpiry,
+	); err != nil {
+		return err
+	}
+	return pwrv.PasswordResetDB.Create(pwr)
+}
+
+func (pwrv *passwordResetValidation) ByToken(token string) (*PasswordReset, error) {
+	pwr := &PasswordReset{
+		Token: token,
+	}
+	if err := runPwResetValFns(pwr, pwrv.tokenHash); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range pwrv.hmac.Hashes(pwr.Token) {
+		var found *PasswordReset
+		if found, err = pwrv.PasswordResetDB.ByToken(tokenHash); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (pwrv *passwordResetValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return pwrv.PasswordResetDB.Delete(id)
+}
+
+func (pwrv *passwordResetValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return pwrv.PasswordResetDB.DeleteByUser(userID)
+}
+
+// ##################### Password Reset Gorm ################################ //
+
+func (pwrg *passwordResetGorm) Create(pwr *PasswordReset) error {
+	return pwrg.db.Create(pwr).Error
+}
+
+// ByToken expects the already hashed token
+func (pwrg *passwordResetGorm) ByToken(tokenHash string) (*PasswordReset, error) {
+	var pwr PasswordReset
+	if err := pwrg.db.Where("token_hash = ?", tokenHash).First(&pwr).Error; err != nil {
+		return nil, err
+	}
+	return &pwr, nil
+}
+
+func (pwrg *passwordResetGorm) Delete(id uint) error {
+	pwr := PasswordReset{Model: gorm.Model{ID: id}}
+	return pwrg.db.Unscoped().Delete(&pwr).Error
+}
+
+func (pwrg *passwordResetGorm) DeleteByUser(userID uint) error {
+	return pwrg.db.Unscoped().Where("user_id = ?", userID).Delete(PasswordReset{}).Error
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Profile gathers a user and every section of their profile, with the
+// fields the viewer is not allowed to see left empty
+type Profile struct {
+	User       *User
+	Visibility *ProfileVisibility
+	Experience []Experience
+	Education  []Education
+	Projects   []Project
+	Skills     []UserSkill
+}
+
+// ProfileService loads profiles as a given viewer would see them. Every
+// page, API response and export goes through it so visibility settings
+// are enforced in one place
+type ProfileService interface {
+	// View loads the full profile of owner as seen by viewer
+	View(owner *User, viewer Viewer) (*Profile, error)
+	// Redact returns a copy of owner without the user fields viewer is
+	// not allowed to see
+	Redact(owner *User, viewer Viewer) (*User, error)
+	// Import fills in the profile of user from profile, overwriting the
+	// fields it has and adding the sections user does not have yet
+	Import(user *User, profile *Profile) error
+}
+
+type profileService struct {
+	us  UserService
+	vs  VisibilityService
+	sks SkillService
+	es  ExperienceService
+	eds EducationService
+	ps  ProjectService
+}
+
+// NewProfileService returns the profile service struct
+func NewProfileService(us UserService, vs VisibilityService, sks SkillService, es ExperienceService,
+	eds EducationService, ps ProjectService) ProfileService {
+	return &profileService{
+		us:  us,
+		vs:  vs,
+		sks: sks,
+		es:  es,
+		eds: eds,
+		ps:  ps,
+	}
+}
+
+func (pfs *profileService) View(owner *User, viewer Viewer) (*Profile, error) {
+	visibility, err := pfs.vs.ByUser(owner.ID)
+	if err != nil {
+		return nil, err
+	}
+	profile := &Profile{
+		User:       redactUser(owner, visibility, viewer),
+		Visibility: visibility,
+	}
+	if visibility.CanSee(visibility.Skills, viewer) {
+		if profile.Skills, err = pfs.sks.UserSkills(owner.ID); err != nil {
+			return nil, err
+		}
+	}
+	if visibility.CanSee(visibility.Experience, viewer) {
+		if profile.Experience, err = pfs.es.ByUser(owner.ID); err != nil {
+			return nil, err
+		}
+	}
+	if visibility.CanSee(visibility.Education, viewer) {
+		if profile.Education, err = pfs.eds.ByUser(owner.ID); err != nil {
+			return nil, err
+		}
+	}
+	if visibility.CanSee(visibility.Projects, viewer) {
+		if profile.Projects, err = pfs.ps.ByUser(owner.ID); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+func (pfs *profileService) Redact(owner *User, viewer Viewer) (*User, error) {
+	visibility, err := pfs.vs.ByUser(owner.ID)
+	if err != nil {
+		return nil, err
+	}
+	return redactUser(owner, visibility, viewer), nil
+}
+
+func (pfs *profileService) Import(user *User, profile *Profile) error {
+	if imported := profile.User; imported != nil {
+		if imported.Name != "" {
+			user.Name = imported.Name
+		}
+		if imported.Title != "" {
+			user.Title = imported.Title
+		}
+		if imported.Summary != "" {
+			user.Summary = imported.Summary
+		}
+		if err := pfs.us.Update(user); err != nil {
+			return err
+		}
+	}
+
+	experience, err := pfs.es.ByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, e := range profile.Experience {
+		if hasExperience(experience, e) {
+			continue
+		}
+		e.Model, e.UserID = gorm.Model{}, user.ID
+		if err := pfs.es.Create(&e); err != nil {
+			return err
+		}
+	}
+
+	education, err := pfs.eds.ByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, e := range profile.Education {
+		if hasEducation(education, e) {
+			continue
+		}
+		e.Model, e.UserID = gorm.Model{}, user.ID
+		if err := pfs.eds.Create(&e); err != nil {
+			return err
+		}
+	}
+
+	projects, err := pfs.ps.ByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, p := range profile.Projects {
+		if hasProject(projects, p) {
+			continue
+		}
+		p.Model, p.UserID = gorm.Model{}, user.ID
+		if err := pfs.ps.Create(&p); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range profile.Skills {
+		if _, err := pfs.sks.AddUserSkill(user, s.Skill.Name, s.Level, s.Years); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasExperience reports whether e is already in list, so importing the
+// same resume twice does not duplicate it
+func hasExperience(list []Experience, e Experience) bool {
+	for _, item := range list {
+		if strings.EqualFold(item.Company, strings.TrimSpace(e.Company)) &&
+			strings.EqualFold(item.Role, strings.TrimSpace(e.Role)) && item.StartDate.Equal(e.StartDate) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEducation(list []Education, e Education) bool {
+	for _, item := range list {
+		if strings.EqualFold(item.School, strings.TrimSpace(e.School)) && item.StartDate.Equal(e.StartDate) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasProject(list []Project, p Project) bool {
+	for _, item := range list {
+		if strings.EqualFold(item.Name, strings.TrimSpace(p.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactUser copies owner, leaving out what viewer may not see along with
+// the secrets no one else should ever get
+func redactUser(owner *User, visibility *ProfileVisibility, viewer Viewer) *User {
+	user := *owner
+	if viewer.User != nil && viewer.User.ID == owner.ID {
+		return &user
+	}
+	user.Password = ""
+	user.PasswordHash = ""
+	user.TOTPSecret = ""
+	if !visibility.CanSee(visibility.Email, viewer) {
+		user.Email = ""
+	}
+	if !visibility.CanSee(visibility.Title, viewer) {
+		user.Title = ""
+	}
+	if !visibility.CanSee(visibility.Summary, viewer) {
+		user.Summary = ""
+	}
+	if !visibility.CanSee(visibility.Skills, viewer) {
+		user.Skills = ""
+	}
+	return &user
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const projectsTable = "projects"
+
+// Project defines the shape of the portfolio project db
+type Project struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;index"`
+	Name        string `gorm:"not null"`
+	URL         string
+	Description string
+	Tech        string
+	Position    int `gorm:"not null"`
+}
+
+// TechList returns the technologies of the project as a slice
+func (p *Project) TechList() []string {
+	if p.Tech == "" {
+		return nil
+	}
+	return strings.Split(p.Tech, ", ")
+}
+
+// ProjectDB defines the shape of the project db interface
+type ProjectDB interface {
+	ByID(id uint) (*Project, error)
+	ByUser(userID uint) ([]Project, error)
+	Create(project *Project) error
+	Update(project *Project) error
+	Delete(id uint) error
+	Move(project *Project, up bool) error
+}
+
+// ProjectService defines the shape of the project service
+type ProjectService interface {
+	ProjectDB
+}
+
+type projectService struct {
+	ProjectDB
+}
+type projectValidation struct {
+	ProjectDB
+}
+type projectGorm struct {
+	db *gorm.DB
+}
+
+// NewProjectService returns the project service struct
+func NewProjectService(db *gorm.DB) ProjectService {
+	pg := newProjectGorm(db)
+	pv := newProjectValidation(pg)
+	return &projectService{
+		ProjectDB: pv,
+	}
+}
+
+func newProjectValidation(pg *projectGorm) *projectValidation {
+	return &projectValidation{
+		ProjectDB: pg,
+	}
+}
+
+func newProjectGorm(db *gorm.DB) *projectGorm {
+	return &projectGorm{
+		db: db,
+	}
+}
+
+// ##################### Project Validation ################################ //
+
+type projectValFn func(project *Project) error
+
+func runProjectValFns(project *Project, fns ...projectValFn) error {
+	for _, fn := range fns {
+		if err := fn(project); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pv *projectValidation) checkForUserID(project *Project) error {
+	if project.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (pv *projectValidation) trimFields(project *Project) error {
+	project.Name = strings.TrimSpace(project.Name)
+	project.URL = strings.TrimSpace(project.URL)
+	project.Description = strings.TrimSpace(project.Description)
+	return nil
+}
+
+func (pv *projectValidation) checkForName(project *Project) error {
+	if project.Name == "" {
+		return ErrProjectNameMissing
+	}
+	return nil
+}
+
+func (pv *projectValidation) normalizeURL(project *Project) error {
+	if project.URL == "" {
+		return nil
+	}
+	if !strings.Contains(project.URL, "://") {
+		project.URL = "https://" + project.URL
+	}
+	u, err := url.Parse(project.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrURLInvalid
+	}
+	project.URL = u.String()
+	return nil
+}
+
+// normalizeTech turns the comma separated tech list into a tidy one
+// without blanks or duplicates
+func (pv *projectValidation) normalizeTech(project *Project) error {
+	var tech []string
+	seen := map[string]bool{}
+	for _, t := range strings.Split(project.Tech, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		tech = append(tech, t)
+	}
+	project.Tech = strings.Join(tech, ", ")
+	return nil
+}
+
+func (pv *projectValidation) ByID(id uint) (*Project, error) {
+	if id == 0 {
+		return nil, ErrIDInvalid
+	}
+	return pv.ProjectDB.ByID(id)
+}
+
+func (pv *projectValidation) ByUser(userID uint) ([]Project, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return pv.ProjectDB.ByUser(userID)
+}
+
+func (pv *projectValidation) Create(project *Project) error {
+	if err := runProjectValFns(project,
+		pv.checkForUserID,
+		pv.trimFields,
+		pv.checkForName,
+		pv.normalizeURL,
+		pv.normalizeTech,
+	); err != nil {
+		return err
+	}
+	return pv.ProjectDB.Create(project)
+}
+
+func (pv *projectValidation) Update(project *Project) error {
+	if err := runProjectValFns(project,
+		pv.checkForUserID,
+		pv.trimFields,
+		pv.checkForName,
+		pv.normalizeURL,
+		pv.normalizeTech,
+	); err != nil {
+		return err
+	}
+	return pv.ProjectDB.Update(project)
+}
+
+func (pv *projectValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return pv.ProjectDB.Delete(id)
+}
+
+// ##################### Project Gorm ################################ //
+
+func (pg *projectGorm) ByID(id uint) (*Project, error) {
+	var project Project
+	if err := pg.db.Where("id = ?", id).First(&project).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (pg *projectGorm) ByUser(userID uint) ([]Project, error) {
+	var projects []Project
+	if err := pg.db.Where("user_id = ?", userID).Order("position asc").Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (pg *projectGorm) Create(project *Project) error {
+	position, err := nextPosition(pg.db, projectsTable, project.UserID)
+	if err != nil {
+		return err
+	}
+	project.Position = position
+	return pg.db.Create(project).Error
+}
+
+func (pg *projectGorm) Update(project *Project) error {
+	return pg.db.Save(project).Error
+}
+
+func (pg *projectGorm) Delete(id uint) error {
+	project := Project{Model: gorm.Model{ID: id}}
+	return pg.db.Unscoped().Delete(&project).Error
+}
+
+func (pg *projectGorm) Move(project *Project, up bool) error {
+	return movePosition(pg.db, projectsTable, project.UserID, project.ID, project.Position, up)
+}
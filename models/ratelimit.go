@@ -0,0 +1,227 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RateLimiter counts consecutive failures against a key, such as an email
+// address or IP, and says how long the key has to wait before trying again
+type RateLimiter interface {
+	// Attempt reserves an attempt for key before it is checked. When key
+	// has to wait it returns how long and counts nothing. Otherwise the
+	// attempt counts as a failure straight away, so parallel attempts
+	// cannot all slip past the backoff, and failures includes it
+	Attempt(key string) (wait time.Duration, failures int, err error)
+	// Refund takes back an attempt that did not turn out to be a failure
+	Refund(key string) error
+	// Reset forgets the failures of key
+	Reset(key string) error
+}
+
+// Backoff decides how long a key waits after consecutive failures. After
+// Free failures the wait starts at Base and doubles up to Max, and from
+// LockAfter failures on the key is locked out for Lockout
+type Backoff struct {
+	Free      int
+	Base      time.Duration
+	Max       time.Duration
+	LockAfter int
+	Lockout   time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Wait returns how long to wait after failures consecutive failures
+func (b Backoff) Wait(failures int) time.Duration {
+	if b.LockAfter > 0 && failures >= b.LockAfter {
+		return b.Lockout
+	}
+	if failures <= b.Free {
+		return 0
+	}
+	wait := b.Base
+	for i := b.Free + 1; i < failures && wait < b.Max; i++ {
+		wait *= 2
+	}
+	if wait > b.Max {
+		wait = b.Max
+	}
+	return wait
+}
+
+// ##################### Memory Rate Limiter ################################ //
+
+// MemoryRateLimiter keeps failures in memory, so limits only hold within
+// one instance. Good for tests and single instance setups
+type MemoryRateLimiter struct {
+	backoff   Backoff
+	mu        sync.Mutex
+	records   map[string]*throttleRecord
+	lastSweep time.Time
+}
+
+type throttleRecord struct {
+	failures     int
+	lastFailedAt time.Time
+	blockedUntil time.Time
+}
+
+// NewMemoryRateLimiter returns an empty in-memory rate limiter
+func NewMemoryRateLimiter(backoff Backoff) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		backoff:   backoff,
+		records:   map[string]*throttleRecord{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Attempt reserves an attempt of key
+func (ml *MemoryRateLimiter) Attempt(key string) (time.Duration, int, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	now := time.Now()
+	ml.sweep(now)
+	record, ok := ml.records[key]
+	if ok && record.blockedUntil.After(now) {
+		return record.blockedUntil.Sub(now), record.failures, nil
+	}
+	if !ok || now.Sub(record.lastFailedAt) > ml.backoff.Window {
+		record = &throttleRecord{}
+		ml.records[key] = record
+	}
+	record.failures++
+	record.lastFailedAt = now
+	record.blockedUntil = now.Add(ml.backoff.Wait(record.failures))
+	return 0, record.failures, nil
+}
+
+// Refund takes back the last attempt of key
+func (ml *MemoryRateLimiter) Refund(key string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	record, ok := ml.records[key]
+	if !ok {
+		return nil
+	}
+	if record.failures <= 1 {
+		delete(ml.records, key)
+		return nil
+	}
+	record.failures--
+	record.blockedUntil = record.lastFailedAt.Add(ml.backoff.Wait(record.failures))
+	return nil
+}
+
+// Reset forgets the failures of key
+func (ml *MemoryRateLimiter) Reset(key string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	delete(ml.records, key)
+	return nil
+}
+
+// sweep drops the records that have fallen out of the window, at most
+// once per window so Fail stays cheap
+func (ml *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(ml.lastSweep) < ml.backoff.Window {
+		return
+	}
+	ml.lastSweep = now
+	for key, record := range ml.records {
+		if now.Sub(record.lastFailedAt) > ml.backoff.Window && now.After(record.blockedUntil) {
+			delete(ml.records, key)
+		}
+	}
+}
+
+// ##################### Postgres Rate Limiter ################################ //
+
+// Throttle defines the shape of the throttles db, the failures of one key
+// shared by every instance of the app
+type Throttle struct {
+	gorm.Model
+	Key          string    `gorm:"not null;unique_index"`
+	Failures     int       `gorm:"not null"`
+	LastFailedAt time.Time `gorm:"not null"`
+	BlockedUntil time.Time `gorm:"not null"`
+}
+
+type throttleGorm struct {
+	db      *gorm.DB
+	backoff Backoff
+}
+
+// NewPostgresRateLimiter returns a rate limiter that keeps failures in
+// the throttles table, so limits hold across instances
+func NewPostgresRateLimiter(db *gorm.DB, backoff Backoff) RateLimiter {
+	return &throttleGorm{
+		db:      db,
+		backoff: backoff,
+	}
+}
+
+// Attempt checks and counts the attempt while holding a lock on the row
+// of key, so parallel attempts on every instance queue up behind it
+func (tg *throttleGorm) Attempt(key string) (time.Duration, int, error) {
+	now := time.Now()
+	var wait time.Duration
+	var failures int
+	err := tg.db.Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockThrottle(tx, key, now)
+		if err != nil {
+			return err
+		}
+		if throttle.BlockedUntil.After(now) {
+			wait, failures = throttle.BlockedUntil.Sub(now), throttle.Failures
+			return nil
+		}
+		if now.Sub(throttle.LastFailedAt) > tg.backoff.Window {
+			throttle.Failures = 0
+		}
+		failures = throttle.Failures + 1
+		return tx.Model(throttle).Updates(map[string]interface{}{
+			"failures":       failures,
+			"last_failed_at": now,
+			"blocked_until":  now.Add(tg.backoff.Wait(failures)),
+		}).Error
+	})
+	return wait, failures, err
+}
+
+func (tg *throttleGorm) Refund(key string) error {
+	return tg.db.Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockThrottle(tx, key, time.Now())
+		if err != nil {
+			return err
+		}
+		if throttle.Failures > 0 {
+			throttle.Failures--
+		}
+		return tx.Model(throttle).Updates(map[string]interface{}{
+			"failures":      throttle.Failures,
+			"blocked_until": throttle.LastFailedAt.Add(tg.backoff.Wait(throttle.Failures)),
+		}).Error
+	})
+}
+
+// lockThrottle creates the row of key if it is missing and locks it until
+// tx ends
+func lockThrottle(tx *gorm.DB, key string, now time.Time) (*Throttle, error) {
+	err := tx.Exec("INSERT INTO throttles (created_at, updated_at, key, failures, last_failed_at, blocked_until) "+
+		"VALUES (?, ?, ?, 0, ?, ?) ON CONFLICT (key) DO NOTHING", now, now, key, now, now).Error
+	if err != nil {
+		return nil, err
+	}
+	var throttle Throttle
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("key = ?", key).First(&throttle).Error; err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+func (tg *throttleGorm) Reset(key string) error {
+	return tg.db.Unscoped().Where("key = ?", key).Delete(Throttle{}).Error
+}
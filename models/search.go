@@ -0,0 +1,404 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// SearchSortRelevance orders results by how well they match the text
+	SearchSortRelevance = "relevance"
+	// SearchSortName orders results by name
+	SearchSortName = "name"
+	// SearchSortNewest orders the most recently joined users first
+	SearchSortNewest = "newest"
+
+	// SearchPerPage is the page size used when none is asked for
+	SearchPerPage = 20
+	// SearchMaxPerPage caps the page size
+	SearchMaxPerPage = 100
+)
+
+// SearchSorts lists every order search results can be sorted in
+var SearchSorts = []string{
+	SearchSortRelevance,
+	SearchSortName,
+	SearchSortNewest,
+}
+
+// SearchQuery describes a search of the people directory
+type SearchQuery struct {
+	Text    string
+	Skill   string
+	Title   string
+	Sort    string
+	Page    int
+	PerPage int
+}
+
+// SearchResult is one page of people matching a search
+type SearchResult struct {
+	Users   []User
+	Total   int
+	Page    int
+	PerPage int
+}
+
+// Pages returns the number of pages the results span
+func (sr *SearchResult) Pages() int {
+	if sr.PerPage == 0 {
+		return 0
+	}
+	return (sr.Total + sr.PerPage - 1) / sr.PerPage
+}
+
+// HasPrev reports whether there is a page before this one
+func (sr *SearchResult) HasPrev() bool {
+	return sr.Page > 1
+}
+
+// HasNext reports whether there is a page after this one
+func (sr *SearchResult) HasNext() bool {
+	return sr.Page < sr.Pages()
+}
+
+// Searcher finds users in the people directory. Only users who picked a
+// username are listed, and only the fields they made public are searched
+type Searcher interface {
+	Search(query SearchQuery) (*SearchResult, error)
+}
+
+// SearchService defines the shape of the search service
+type SearchService interface {
+	Searcher
+}
+
+type searchService struct {
+	Searcher
+}
+type searchValidation struct {
+	Searcher
+}
+type searchGorm struct {
+	db *gorm.DB
+}
+
+// NewSearchService returns the search service struct backed by searcher
+func NewSearchService(searcher Searcher) SearchService {
+	sv := newSearchValidation(searcher)
+	return &searchService{
+		Searcher: sv,
+	}
+}
+
+func newSearchValidation(searcher Searcher) *searchValidation {
+	return &searchValidation{
+		Searcher: searcher,
+	}
+}
+
+// NewSearchGorm returns a searcher using PostgreSQL full text search
+func NewSearchGorm(db *gorm.DB) Searcher {
+	return &searchGorm{
+		db: db,
+	}
+}
+
+// ##################### Search Validation ################################ //
+
+type searchValFn func(query *SearchQuery) error
+
+func runSearchValFns(query *SearchQuery, fns ...searchValFn) error {
+	for _, fn := range fns {
+		if err := fn(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sv *searchValidation) trimFields(query *SearchQuery) error {
+	query.Text = strings.Join(strings.Fields(query.Text), " ")
+	query.Skill = strings.TrimSpace(query.Skill)
+	query.Title = strings.TrimSpace(query.Title)
+	return nil
+}
+
+func (sv *searchValidation) setSort(query *SearchQuery) error {
+	switch query.Sort {
+	case SearchSortName, SearchSortNewest:
+	case SearchSortRelevance:
+		if query.Text == "" {
+			query.Sort = SearchSortName
+		}
+	case "":
+		query.Sort = SearchSortName
+		if query.Text != "" {
+			query.Sort = SearchSortRelevance
+		}
+	default:
+		return ErrSortInvalid
+	}
+	return nil
+}
+
+func (sv *searchValidation) setPage(query *SearchQuery) error {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PerPage < 1 {
+		query.PerPage = SearchPerPage
+	}
+	if query.PerPage > SearchMaxPerPage {
+		query.PerPage = SearchMaxPerPage
+	}
+	return nil
+}
+
+func (sv *searchValidation) Search(query SearchQuery) (*SearchResult, error) {
+	if err := runSearchValFns(&query,
+		sv.trimFields,
+		sv.setSort,
+		sv.setPage,
+	); err != nil {
+		return nil, err
+	}
+	return sv.Searcher.Search(query)
+}
+
+// ##################### Search Gorm ################################ //
+
+// searchTSQuery turns the search text into a tsquery matching every word
+const searchTSQuery = "plainto_tsquery('simple', ?)"
+
+func (sg *searchGorm) Search(query SearchQuery) (*SearchResult, error) {
+	db := sg.db.Model(&User{}).
+		Joins("LEFT JOIN profile_visibilities pv ON pv.user_id = users.id AND pv.deleted_at IS NULL").
+		Where("users.username <> ''")
+	if query.Text != "" {
+		db = db.Where("users.search_vector @@ "+searchTSQuery, query.Text)
+	}
+	if query.Title != "" {
+		db = db.Where("COALESCE(pv.title, ?) = ? AND users.title ILIKE ?",
+			VisibilityPublic, VisibilityPublic, "%"+escapeLike(query.Title)+"%")
+	}
+	if query.Skill != "" {
+		slug := skillSlug(query.Skill)
+		db = db.Where("COALESCE(pv.skills, ?) = ? AND EXISTS (SELECT 1 FROM user_skills "+
+			"JOIN skills ON skills.id = user_skills.skill_id WHERE user_skills.user_id = users.id "+
+			"AND user_skills.deleted_at IS NULL AND (skills.slug = ? OR skills.id IN "+
+			"(SELECT skill_id FROM skill_aliases WHERE alias = ?)))",
+			VisibilityPublic, VisibilityPublic, slug, slug)
+	}
+
+	result := &SearchResult{Page: query.Page, PerPage: query.PerPage}
+	if err := db.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	switch query.Sort {
+	case SearchSortRelevance:
+		db = db.Order(gorm.Expr("ts_rank_cd(users.search_vector, "+searchTSQuery+") DESC", query.Text))
+	case SearchSortNewest:
+		db = db.Order("users.created_at DESC")
+	}
+	db = db.Order("users.name ASC").Order("users.id ASC")
+	err := db.Select("users.*").
+		Offset((query.Page - 1) * query.PerPage).
+		Limit(query.PerPage).
+		Find(&result.Users).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// indexUser rebuilds the search vector of user from the fields they made
+// public. It runs whenever a user or their visibility settings are saved
+func indexUser(db *gorm.DB, user *User) error {
+	visibility, err := newVisibilityGorm(db).ByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	doc := searchDocument(user, visibility)
+	return db.Exec("UPDATE users SET search_vector = "+
+		"setweight(to_tsvector('simple', ?), 'A') || setweight(to_tsvector('simple', ?), 'B') || "+
+		"setweight(to_tsvector('simple', ?), 'C') || setweight(to_tsvector('simple', ?), 'D') "+
+		"WHERE id = ?", doc[0], doc[1], doc[2], doc[3], user.ID).Error
+}
+
+// searchDocument returns the searchable text of user from most to least
+// important, leaving out the fields that are not public
+func searchDocument(user *User, visibility *ProfileVisibility) [4]string {
+	var doc [4]string
+	doc[0] = user.Name + " " + user.Username
+	if visibility.Title == VisibilityPublic {
+		doc[1] = user.Title
+	}
+	if visibility.Skills == VisibilityPublic {
+		doc[2] = user.Skills
+	}
+	if visibility.Summary == VisibilityPublic {
+		doc[3] = user.Summary
+	}
+	return doc
+}
+
+// AfterSave keeps the search vector of the user up to date
+func (u *User) AfterSave(tx *gorm.DB) error {
+	return indexUser(tx, u)
+}
+
+// AfterSave reindexes the user, since what is public may have changed
+func (pv *ProfileVisibility) AfterSave(tx *gorm.DB) error {
+	var user User
+	if err := tx.Where("id = ?", pv.UserID).First(&user).Error; err != nil {
+		return err
+	}
+	return indexUser(tx, &user)
+}
+
+// ##################### Memory Searcher ################################ //
+
+// searchWeights mirror the default ts_rank weights of the A to D fields
+var searchWeights = [4]float64{1.0, 0.4, 0.2, 0.1}
+
+// MemorySearcher is an in-memory Searcher for tests and small setups. It
+// follows the same rules as the PostgreSQL one
+type MemorySearcher struct {
+	mu   sync.RWMutex
+	docs map[uint]memoryDoc
+}
+
+type memoryDoc struct {
+	user       User
+	visibility ProfileVisibility
+	skills     []string
+}
+
+// NewMemorySearcher returns an empty MemorySearcher
+func NewMemorySearcher() *MemorySearcher {
+	return &MemorySearcher{
+		docs: make(map[uint]memoryDoc),
+	}
+}
+
+// Index adds or replaces user along with their visibility settings and
+// canonical skill names
+func (ms *MemorySearcher) Index(user User, visibility *ProfileVisibility, skills []string) {
+	if visibility == nil {
+		visibility = DefaultProfileVisibility(user.ID)
+	}
+	slugs := make([]string, 0, len(skills))
+	for _, skill := range skills {
+		slugs = append(slugs, skillSlug(skill))
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.docs[user.ID] = memoryDoc{
+		user:       user,
+		visibility: *visibility,
+		skills:     slugs,
+	}
+}
+
+// Remove drops the user with id from the index
+func (ms *MemorySearcher) Remove(id uint) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.docs, id)
+}
+
+// Search finds the indexed users matching query
+func (ms *MemorySearcher) Search(query SearchQuery) (*SearchResult, error) {
+	type hit struct {
+		user User
+		rank float64
+	}
+	terms := strings.Fields(strings.ToLower(query.Text))
+	title := strings.ToLower(query.Title)
+	skill := skillSlug(query.Skill)
+
+	ms.mu.RLock()
+	var hits []hit
+	for _, doc := range ms.docs {
+		if doc.user.Username == "" {
+			continue
+		}
+		if title != "" && (doc.visibility.Title != VisibilityPublic ||
+			!strings.Contains(strings.ToLower(doc.user.Title), title)) {
+			continue
+		}
+		if skill != "" && (doc.visibility.Skills != VisibilityPublic || !containsString(doc.skills, skill)) {
+			continue
+		}
+		rank, ok := memoryRank(searchDocument(&doc.user, &doc.visibility), terms)
+		if !ok {
+			continue
+		}
+		hits = append(hits, hit{user: doc.user, rank: rank})
+	}
+	ms.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch {
+		case query.Sort == SearchSortRelevance && a.rank != b.rank:
+			return a.rank > b.rank
+		case query.Sort == SearchSortNewest && !a.user.CreatedAt.Equal(b.user.CreatedAt):
+			return a.user.CreatedAt.After(b.user.CreatedAt)
+		case a.user.Name != b.user.Name:
+			return a.user.Name < b.user.Name
+		}
+		return a.user.ID < b.user.ID
+	})
+
+	result := &SearchResult{Total: len(hits), Page: query.Page, PerPage: query.PerPage}
+	start := (query.Page - 1) * query.PerPage
+	for i := start; i < len(hits) && i < start+query.PerPage; i++ {
+		result.Users = append(result.Users, hits[i].user)
+	}
+	return result, nil
+}
+
+// memoryRank scores doc against terms, every term has to appear somewhere
+func memoryRank(doc [4]string, terms []string) (float64, bool) {
+	var fields [4][]string
+	for i, text := range doc {
+		fields[i] = strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return r == ' ' || r == ',' || r == '.' || r == '\n' || r == '\t'
+		})
+	}
+	var rank float64
+	for _, term := range terms {
+		found := false
+		for i, words := range fields {
+			for _, word := range words {
+				if word == term {
+					rank += searchWeights[i]
+					found = true
+				}
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
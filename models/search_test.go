@@ -0,0 +1,396 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// newTestSearch returns a search service over a MemorySearcher holding a
+// small directory. Alan keeps his skills private, Grace her title and
+// Linus his summary, and Hidden never picked a username
+func newTestSearch() SearchService {
+	ms := NewMemorySearcher()
+	add := func(id uint, name, username, title, summary string, skills []string, joined int, private func(*ProfileVisibility)) {
+		user := User{
+			Model:    gorm.Model{ID: id, CreatedAt: time.Date(joined, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			Name:     name,
+			Email:    username + "@example.com",
+			Username: username,
+			Title:    title,
+			Summary:  summary,
+		}
+		for i, skill := range skills {
+			if i > 0 {
+				user.Skills += ", "
+			}
+			user.Skills += skill
+		}
+		visibility := DefaultProfileVisibility(id)
+		if private != nil {
+			private(visibility)
+		}
+		ms.Index(user, visibility, skills)
+	}
+	add(1, "Ada Lovelace", "ada", "Software Engineer", "Writes Go services.", []string{"Go", "Mathematics"}, 2019, nil)
+	add(2, "Grace Hopper", "grace", "Compiler Engineer", "Built the first compiler.", []string{"COBOL"}, 2021,
+		func(pv *ProfileVisibility) { pv.Title = VisibilityPrivate })
+	add(3, "Alan Turing", "alan", "Mathematician", "Plays chess on weekends.", []string{"Go"}, 2018,
+		func(pv *ProfileVisibility) { pv.Skills = VisibilityUsers })
+	add(4, "Hidden Go", "", "Go Engineer", "", []string{"Go"}, 2022, nil)
+	add(5, "Linus Torvalds", "linus", "Kernel Engineer", "Secretword in a private summary.", []string{"C"}, 2020,
+		func(pv *ProfileVisibility) { pv.Summary = VisibilityPrivate })
+	add(6, "Go Gopher", "gopher", "Mascot", "", []string{"Go"}, 2023, nil)
+	return NewSearchService(ms)
+}
+
+func usernames(users []User) []string {
+	names := []string{}
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
+func TestMemorySearcherMatching(t *testing.T) {
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{"everyone with a username by name", SearchQuery{}, []string{"ada", "alan", "gopher", "grace", "linus"}},
+		{"ranked by field weight", SearchQuery{Text: "go"}, []string{"gopher", "ada"}},
+		{"every word has to match", SearchQuery{Text: "go mathematics"}, []string{"ada"}},
+		{"text is case insensitive", SearchQuery{Text: "  LOVELACE "}, []string{"ada"}},
+		{"username is searched", SearchQuery{Text: "gopher"}, []string{"gopher"}},
+		{"newest first", SearchQuery{Text: "engineer", Sort: SearchSortNewest}, []string{"linus", "ada"}},
+		{"by name with text", SearchQuery{Text: "go", Sort: SearchSortName}, []string{"ada", "gopher"}},
+		{"skill filter", SearchQuery{Skill: "go"}, []string{"ada", "gopher"}},
+		{"skill filter ignores case and spaces", SearchQuery{Skill: "  GO "}, []string{"ada", "gopher"}},
+		{"skill filter needs the whole skill", SearchQuery{Skill: "g"}, []string{}},
+		{"title filter", SearchQuery{Title: "engineer"}, []string{"ada", "linus"}},
+		{"title filter matches part of the title", SearchQuery{Title: "soft"}, []string{"ada"}},
+		{"filters combine", SearchQuery{Text: "go", Skill: "go", Title: "engineer"}, []string{"ada"}},
+		{"no match", SearchQuery{Text: "fortran"}, []string{}},
+	}
+	ss := newTestSearch()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ss.Search(tc.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if got := usernames(result.Users); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Search() = %v, want %v", got, tc.want)
+			}
+			if result.Total != len(tc.want) {
+				t.Errorf("Total = %d, want %d", result.Total, len(tc.want))
+			}
+		})
+	}
+}
+
+func TestMemorySearcherPublicFieldsOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		query SearchQuery
+	}{
+		{"private title is not searched", SearchQuery{Text: "compiler engineer"}},
+		{"private title is not filtered on", SearchQuery{Title: "compiler"}},
+		{"private summary is not searched", SearchQuery{Text: "secretword"}},
+		{"skills visible to users only are not searched", SearchQuery{Text: "alan go"}},
+		{"skills visible to users only are not filtered on", SearchQuery{Skill: "go", Text: "alan"}},
+		{"email is never searched", SearchQuery{Text: "ada@example.com"}},
+		{"users without a username are not listed", SearchQuery{Text: "hidden"}},
+	}
+	ss := newTestSearch()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ss.Search(tc.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if result.Total != 0 || len(result.Users) != 0 {
+				t.Errorf("Search() = %v, want no results", usernames(result.Users))
+			}
+		})
+	}
+
+	// the public fields of the same users are found
+	result, err := ss.Search(SearchQuery{Text: "compiler"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(result.Users); !reflect.DeepEqual(got, []string{"grace"}) {
+		t.Errorf("public summary: Search() = %v, want [grace]", got)
+	}
+}
+
+func TestMemorySearcherPagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     SearchQuery
+		want      []string
+		wantPage  int
+		wantPer   int
+		wantPages int
+		wantPrev  bool
+		wantNext  bool
+	}{
+		{"first page", SearchQuery{PerPage: 2}, []string{"ada", "alan"}, 1, 2, 3, false, true},
+		{"middle page", SearchQuery{Page: 2, PerPage: 2}, []string{"gopher", "grace"}, 2, 2, 3, true, true},
+		{"last page", SearchQuery{Page: 3, PerPage: 2}, []string{"linus"}, 3, 2, 3, true, false},
+		{"past the end", SearchQuery{Page: 4, PerPage: 2}, []string{}, 4, 2, 3, true, false},
+		{"page below one", SearchQuery{Page: -1, PerPage: 2}, []string{"ada", "alan"}, 1, 2, 3, false, true},
+		{"default page size", SearchQuery{}, []string{"ada", "alan", "gopher", "grace", "linus"}, 1, SearchPerPage, 1, false, false},
+		{"page size is capped", SearchQuery{PerPage: 1000}, []string{"ada", "alan", "gopher", "grace", "linus"}, 1, SearchMaxPerPage, 1, false, false},
+	}
+	ss := newTestSearch()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ss.Search(tc.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if got := usernames(result.Users); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Users = %v, want %v", got, tc.want)
+			}
+			if result.Total != 5 {
+				t.Errorf("Total = %d, want 5", result.Total)
+			}
+			if result.Page != tc.wantPage || result.PerPage != tc.wantPer {
+				t.Errorf("page %d of size %d, want %d of size %d", result.Page, result.PerPage, tc.wantPage, tc.wantPer)
+			}
+			if result.Pages() != tc.wantPages || result.HasPrev() != tc.wantPrev || result.HasNext() != tc.wantNext {
+				t.Errorf("Pages() = %d, HasPrev() = %v, HasNext() = %v, want %d, %v, %v",
+					result.Pages(), result.HasPrev(), result.HasNext(), tc.wantPages, tc.wantPrev, tc.wantNext)
+			}
+		})
+	}
+}
+
+func TestSearchSortInvalid(t *testing.T) {
+	if _, err := newTestSearch().Search(SearchQuery{Sort: "age"}); err != ErrSortInvalid {
+		t.Errorf("Search() error = %v, want %v", err, ErrSortInvalid)
+	}
+}
+
+func TestSearchDocument(t *testing.T) {
+	user := &User{
+		Name:     "Ada Lovelace",
+		Username: "ada",
+		Title:    "Engineer",
+		Skills:   "Go, Mathematics",
+		Summary:  "Writes programs.",
+	}
+	tests := []struct {
+		name    string
+		private func(*ProfileVisibility)
+		want    [4]string
+	}{
+		{"defaults", nil, [4]string{"Ada Lovelace ada", "Engineer", "Go, Mathematics", "Writes programs."}},
+		{"private title", func(pv *ProfileVisibility) { pv.Title = VisibilityPrivate },
+			[4]string{"Ada Lovelace ada", "", "Go, Mathematics", "Writes programs."}},
+		{"skills for users only", func(pv *ProfileVisibility) { pv.Skills = VisibilityUsers },
+			[4]string{"Ada Lovelace ada", "Engineer", "", "Writes programs."}},
+		{"private summary", func(pv *ProfileVisibility) { pv.Summary = VisibilityPrivate },
+			[4]string{"Ada Lovelace ada", "Engineer", "Go, Mathematics", ""}},
+		{"name is always public", func(pv *ProfileVisibility) {
+			pv.Email, pv.Title, pv.Skills, pv.Summary = VisibilityPrivate, VisibilityPrivate, VisibilityPrivate, VisibilityPrivate
+		}, [4]string{"Ada Lovelace ada", "", "", ""}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			visibility := DefaultProfileVisibility(1)
+			if tc.private != nil {
+				tc.private(visibility)
+			}
+			if got := searchDocument(user, visibility); got != tc.want {
+				t.Errorf("searchDocument() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// recordingDriver is a database/sql driver that records the statements
+// it is given and answers every query with no rows, so the SQL searchGorm
+// builds can be checked without a database
+type recordingDriver struct {
+	mu      sync.Mutex
+	queries []recordedQuery
+}
+
+type recordedQuery struct {
+	sql  string
+	args []driver.Value
+}
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("models-recorder", recorder)
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return recordingConn{}, nil
+}
+
+func (d *recordingDriver) record(query string, args []driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, recordedQuery{sql: query, args: args})
+}
+
+// take returns and forgets the recorded statements
+func (d *recordingDriver) take() []recordedQuery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	queries := d.queries
+	d.queries = nil
+	return queries
+}
+
+type recordingConn struct{}
+
+func (recordingConn) Prepare(query string) (driver.Stmt, error) { return recordingStmt(query), nil }
+func (recordingConn) Close() error                              { return nil }
+func (recordingConn) Begin() (driver.Tx, error)                 { return nil, errors.New("recorder: no transactions") }
+
+type recordingStmt string
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	recorder.record(string(s), args)
+	return driver.RowsAffected(0), nil
+}
+
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	recorder.record(string(s), args)
+	if strings.Contains(string(s), "count(*)") {
+		return &recordingRows{columns: []string{"count"}, rows: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return &recordingRows{columns: []string{"id"}}, nil
+}
+
+type recordingRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string { return r.columns }
+func (r *recordingRows) Close() error      { return nil }
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var placeholder = regexp.MustCompile(`\$\d+`)
+
+func TestSearchGormQuery(t *testing.T) {
+	sqlDB, err := sql.Open("models-recorder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ss := NewSearchService(NewSearchGorm(db))
+
+	// every search lists only users with a username and joins their
+	// visibility settings, which are missing for users who never saved any
+	always := []string{
+		`LEFT JOIN profile_visibilities pv ON pv.user_id = users.id AND pv.deleted_at IS NULL`,
+		`"users"."deleted_at" IS NULL`,
+		`users.username <> ''`,
+	}
+	tests := []struct {
+		name      string
+		query     SearchQuery
+		where     []string
+		whereArgs []driver.Value
+		order     string
+		pageArgs  string
+	}{
+		{
+			name:     "everyone",
+			query:    SearchQuery{},
+			order:    `ORDER BY users.name ASC,users.id ASC`,
+			pageArgs: `LIMIT 20 OFFSET 0`,
+		},
+		{
+			name:      "text searches the public search vector",
+			query:     SearchQuery{Text: "  go   engineer "},
+			where:     []string{`users.search_vector @@ plainto_tsquery('simple', ?)`},
+			whereArgs: []driver.Value{"go engineer"},
+			order:     `ORDER BY ts_rank_cd(users.search_vector, plainto_tsquery('simple', ?)) DESC,users.name ASC,users.id ASC`,
+			pageArgs:  `LIMIT 20 OFFSET 0`,
+		},
+		{
+			name:      "title filter only matches public titles",
+			query:     SearchQuery{Title: "100%_eng"},
+			where:     []string{`COALESCE(pv.title, ?) = ? AND users.title ILIKE ?`},
+			whereArgs: []driver.Value{"public", "public", `%100\%\_eng%`},
+			order:     `ORDER BY users.name ASC,users.id ASC`,
+			pageArgs:  `LIMIT 20 OFFSET 0`,
+		},
+		{
+			name:  "skill filter only matches public skills",
+			query: SearchQuery{Skill: "  Go  Lang ", Sort: SearchSortNewest, Page: 3, PerPage: 10},
+			where: []string{`COALESCE(pv.skills, ?) = ? AND EXISTS (SELECT 1 FROM user_skills JOIN skills ON skills.id = user_skills.skill_id ` +
+				`WHERE user_skills.user_id = users.id AND user_skills.deleted_at IS NULL AND (skills.slug = ? OR skills.id IN ` +
+				`(SELECT skill_id FROM skill_aliases WHERE alias = ?)))`},
+			whereArgs: []driver.Value{"public", "public", "go lang", "go lang"},
+			order:     `ORDER BY users.created_at DESC,users.name ASC,users.id ASC`,
+			pageArgs:  `LIMIT 10 OFFSET 20`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder.take()
+			if _, err := ss.Search(tc.query); err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			queries := recorder.take()
+			if len(queries) != 2 {
+				t.Fatalf("ran %d statements, want a count and a select", len(queries))
+			}
+			count, find := queries[0], queries[1]
+			for _, q := range queries {
+				sql := placeholder.ReplaceAllString(q.sql, "?")
+				for _, want := range append(always, tc.where...) {
+					if !strings.Contains(sql, want) {
+						t.Errorf("statement does not contain %q:\n%s", want, sql)
+					}
+				}
+			}
+			if len(count.args)+len(tc.whereArgs) > 0 && !reflect.DeepEqual(count.args, tc.whereArgs) {
+				t.Errorf("count args = %q, want %q", count.args, tc.whereArgs)
+			}
+			sql := placeholder.ReplaceAllString(find.sql, "?")
+			if !strings.HasPrefix(sql, "SELECT users.* FROM") {
+				t.Errorf("select does not start with the user columns:\n%s", sql)
+			}
+			if !strings.Contains(sql, tc.order+" "+tc.pageArgs) {
+				t.Errorf("select does not end with %q:\n%s", tc.order+" "+tc.pageArgs, sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// nextPosition returns the position after the last row the user has in table
+func nextPosition(db *gorm.DB, table string, userID uint) (int, error) {
+	var next int
+	row := db.Table(table).Where("user_id = ?", userID).Select("COALESCE(MAX(position) + 1, 0)").Row()
+	if err := row.Scan(&next); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// movePosition swaps the row at position with its neighbour above or below
+// it. Moving the first row up or the last row down does nothing
+func movePosition(db *gorm.DB, table string, userID, id uint, position int, up bool) error {
+	op, order := ">", "position asc"
+	if up {
+		op, order = "<", "position desc"
+	}
+	var neighbour struct {
+		ID       uint
+		Position int
+	}
+	err := db.Table(table).Select("id, position").
+		Where("user_id = ? AND position "+op+" ?", userID, position).
+		Order(order).Limit(1).Scan(&neighbour).Error
+	if gorm.IsRecordNotFoundError(err) || neighbour.ID == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(table).Where("id = ?", neighbour.ID).UpdateColumn("position", position).Error; err != nil {
+			return err
+		}
+		return tx.Table(table).Where("id = ?", id).UpdateColumn("position", neighbour.Position).Error
+	})
+}
+
+// checkDateRange makes sure a section has a start date and does not end
+// before it starts. A nil end means the section is ongoing
+func checkDateRange(start time.Time, end *time.Time) error {
+	if start.IsZero() {
+		return ErrStartDateMissing
+	}
+	if end != nil && end.Before(start) {
+		return ErrDateOrder
+	}
+	return nil
+}
@@ -2,40 +2,116 @@ package models
 
 import (
 	"github.com/jinzhu/gorm"
+
+	"profile.com/config"
+	"profile.com/hash"
+	"profile.com/migrate"
+	"profile.com/storage"
 )
 
 // Services defines the shape of the service struct
 type Services struct {
-	db   *gorm.DB
-	User UserService
+	db *gorm.DB
+	// HMAC hashes stored tokens with the keys of the HMAC keyring
+	HMAC          hash.HMAC
+	User          UserService
+	Login         LoginService
+	PasswordReset PasswordResetService
+	Verification  EmailVerificationService
+	Session       SessionService
+	TwoFactor     TwoFactorService
+	APIToken      APITokenService
+	Experience    ExperienceService
+	Education     EducationService
+	Project       ProjectService
+	Skill         SkillService
+	Visibility    VisibilityService
+	Profile       ProfileService
+	Search        SearchService
+	Avatar        AvatarService
+	Buckets       BucketStore
 }
 
-// NewServices is used to define the service shape
-func NewServices(connectionString string) (*Services, error) {
-	db, err := gorm.Open("postgres", connectionString)
-	db.LogMode(true)
-	userService := NewUserService(db)
+// NewServices is used to define the service shape, uploads are kept in blob
+func NewServices(cfg *config.Config, blob storage.Blob) (*Services, error) {
+	passwords, err := hash.NewPasswordHasher(cfg.PasswordOptions())
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := cfg.Keyring()
+	if err != nil {
+		return nil, err
+	}
+	hmac, err := keyring.HMAC()
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open("postgres", cfg.Database.ConnectionInfo())
 	if err != nil {
 		return nil, err
 	}
+	db.LogMode(!cfg.IsProduction())
+	userService := NewUserService(db, passwords)
+	experienceService := NewExperienceService(db)
+	educationService := NewEducationService(db)
+	projectService := NewProjectService(db)
+	skillService := NewSkillService(db, userService)
+	visibilityService := NewVisibilityService(db)
+	newLimiter := func(b Backoff) RateLimiter {
+		return NewMemoryRateLimiter(b)
+	}
+	var buckets BucketStore = NewMemoryBucketStore()
+	if cfg.RateLimitStore == "postgres" {
+		newLimiter = func(b Backoff) RateLimiter {
+			return NewPostgresRateLimiter(db, b)
+		}
+		buckets = NewPostgresBucketStore(db)
+	}
+	profileService := NewProfileService(userService, visibilityService, skillService, experienceService,
+		educationService, projectService)
 	return &Services{
-		User: userService,
-		db:   db,
+		User:          userService,
+		Login:         NewLoginService(db, userService, newLimiter, hmac),
+		PasswordReset: NewPasswordResetService(db, userService, hmac),
+		Verification:  NewEmailVerificationService(db, userService, hmac),
+		Session:       NewSessionService(db, userService, hmac),
+		TwoFactor:     NewTwoFactorService(db, userService, hmac, newLimiter(AccountBackoff)),
+		APIToken:      NewAPITokenService(db, userService, hmac),
+		Experience:    experienceService,
+		Education:     educationService,
+		Project:       projectService,
+		Skill:         skillService,
+		Visibility:    visibilityService,
+		Profile:       profileService,
+		Search:        NewSearchService(NewSearchGorm(db)),
+		Avatar:        NewAvatarService(userService, blob),
+		Buckets:       buckets,
+		HMAC:          hmac,
+		db:            db,
 	}, nil
 }
 
-// AutoMigrate creates the tables in the database
-func (s *Services) AutoMigrate() error {
-	if err := s.db.AutoMigrate(User{}).Error; err != nil {
+// Migrator returns the migrator for the versioned schema migrations
+func (s *Services) Migrator() (*migrate.Migrator, error) {
+	return migrate.New(s.db.DB())
+}
+
+// Migrate applies every pending schema migration
+func (s *Services) Migrate() error {
+	m, err := s.Migrator()
+	if err != nil {
 		return err
 	}
-	return nil
+	_, err = m.Up()
+	return err
 }
 
-// DestructiveConstruct destroys db and recreates
+// DestructiveConstruct rolls back every migration and applies them again,
+// leaving an empty database
 func (s *Services) DestructiveConstruct() error {
-	if err := s.db.DropTableIfExists(User{}).Error; err != nil {
+	m, err := s.Migrator()
+	if err != nil {
 		return err
 	}
-	return s.AutoMigrate()
+	return m.Reset()
 }
@@ -0,0 +1,320 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+const (
+	// SessionTTL is how long a session lives without being used
+	SessionTTL = 30 * 24 * time.Hour
+	// sessionTouchInterval limits how often last seen is written to the db
+	sessionTouchInterval = time.Minute
+)
+
+// Session defines the shape of the session db. It holds the remember
+// tokens that used to live on users: only the HMAC of a token is stored,
+// and cookies are hashed by the validation layer and looked up by the
+// indexed token_hash. The baseline migration drops the old users.remember
+// and users.remember_hash columns, signing out every older token
+type Session struct {
+	gorm.Model
+	UserID     uint   `gorm:"not null;index"`
+	Token      string `gorm:"-"`
+	TokenHash  string `gorm:"not null;unique_index"`
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+}
+
+// SessionDB defines the shape of the session db interface
+type SessionDB interface {
+	Create(session *Session) error
+	ByToken(token string) (*Session, error)
+	ByUser(userID uint) ([]Session, error)
+	Update(session *Session) error
+	Delete(id uint) error
+	DeleteByUser(userID uint) error
+	DeleteExpired() error
+}
+
+// SessionService defines the shape of the session service
+type SessionService interface {
+	Start(user *User, userAgent, ip string) (*Session, error)
+	UserByToken(token string) (*User, *Session, error)
+	Revoke(userID, id uint) error
+	SessionDB
+}
+
+type sessionService struct {
+	SessionDB
+	us UserService
+}
+type sessionValidation struct {
+	SessionDB
+	hmac hash.HMAC
+}
+type sessionGorm struct {
+	db *gorm.DB
+}
+
+// NewSessionService returns the session service struct
+func NewSessionService(db *gorm.DB, us UserService, hmac hash.HMAC) SessionService {
+	sg := newSessionGorm(db)
+	sv := newSessionValidation(sg, hmac)
+	return &sessionService{
+		SessionDB: sv,
+		us:        us,
+	}
+}
+
+func newSessionValidation(sg *sessionGorm, hmac hash.HMAC) *sessionValidation {
+	return &sessionValidation{
+		hmac:      hmac,
+		SessionDB: sg,
+	}
+}
+
+func newSessionGorm(db *gorm.DB) *sessionGorm {
+	return &sessionGorm{
+		db: db,
+	}
+}
+
+// ##################### Session Service ################################ //
+
+// Start creates a new session for the user on the device described by
+// userAgent and ip
+func (ss *sessionService) Start(user *User, userAgent, ip string) (*Session, error) {
+	if err := ss.SessionDB.DeleteExpired(); err != nil {
+		return nil, err
+	}
+	session := Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	if err := ss.SessionDB.Create(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UserByToken resolves the session token to its user and slides the
+// session expiry forward
+func (ss *sessionService) UserByToken(token string) (*User, *Session, error) {
+	session, err := ss.SessionDB.ByToken(token)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		ss.SessionDB.Delete(session.ID)
+		return nil, nil, ErrNotFound
+	}
+	user, err := ss.us.ByID(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(SessionTTL)
+		if err := ss.SessionDB.Update(session); err != nil {
+			return nil, nil, err
+		}
+	}
+	session.Token = token
+	return user, session, nil
+}
+
+// Revoke deletes one of the user's sessions
+func (ss *sessionService) Revoke(userID, id uint) error {
+	sessions, err := ss.SessionDB.ByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if s.ID == id {
+			return ss.SessionDB.Delete(id)
+		}
+	}
+	return ErrNotFound
+}
+
+// ##################### Session Validation ################################ //
+
+type sessionValFn func(session *Session) error
+
+func runSessionValFns(session *Session, fns ...sessionValFn) error {
+	for _, fn := range fns {
+		if err := fn(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sv *sessionValidation) checkForUserID(session *Session) error {
+	if session.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (sv *sessionValidation) generateToken(session *Session) error {
+	if session.Token != "" {
+		return nil
+	}
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	session.Token = token
+	return nil
+}
+
+func (sv *sessionValidation) tokenHash(session *Session) error {
+	if session.Token == "" {
+		return nil
+	}
+	session.TokenHash = sv.hmac.Hash(session.Token)
+	return nil
+}
+
+func (sv *sessionValidation) checkForTokenHash(session *Session) error {
+	if session.TokenHash == "" {
+		return ErrRememberMissing
+	}
+	return nil
+}
+
+func (sv *sessionValidation) setTimes(session *Session) error {
+	now := time.Now()
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = now
+	}
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = now.Add(SessionTTL)
+	}
+	return nil
+}
+
+func (sv *sessionValidation) Create(session *Session) error {
+	if err := runSessionValFns(session,
+		sv.checkForUserID,
+		sv.generateToken,
+		sv.tokenHash,
+		sv.checkForTokenHash,
+		sv.setTimes,
+	); err != nil {
+		return err
+	}
+	return sv.SessionDB.Create(session)
+}
+
+func (sv *sessionValidation) ByToken(token string) (*Session, error) {
+	session := &Session{
+		Token: token,
+	}
+	if err := runSessionValFns(session,
+		sv.tokenHash,
+		sv.checkForTokenHash,
+	); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range sv.hmac.Hashes(session.Token) {
+		var found *Session
+		if found, err = sv.SessionDB.ByToken(tokenHash); err != nil {
+			continue
+		}
+		// Move sessions hashed with an old key onto the active one, so
+		// they outlive the key's grace period
+		if found.TokenHash != session.TokenHash {
+			found.TokenHash = session.TokenHash
+			if err := sv.SessionDB.Update(found); err != nil {
+				return nil, err
+			}
+		}
+		return found, nil
+	}
+	return nil, err
+}
+
+func (sv *sessionValidation) ByUser(userID uint) ([]Session, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return sv.SessionDB.ByUser(userID)
+}
+
+func (sv *sessionValidation) Update(session *Session) error {
+	if err := runSessionValFns(session,
+		sv.checkForUserID,
+		sv.checkForTokenHash,
+	); err != nil {
+		return err
+	}
+	return sv.SessionDB.Update(session)
+}
+
+func (sv *sessionValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return sv.SessionDB.Delete(id)
+}
+
+func (sv *sessionValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return sv.SessionDB.DeleteByUser(userID)
+}
+
+// ##################### Session Gorm ################################ //
+
+func (sg *sessionGorm) Create(session *Session) error {
+	return sg.db.Create(session).Error
+}
+
+// ByToken expects the already hashed token
+func (sg *sessionGorm) ByToken(tokenHash string) (*Session, error) {
+	var session Session
+	if err := sg.db.Where("token_hash = ?", tokenHash).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (sg *sessionGorm) ByUser(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := sg.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (sg *sessionGorm) Update(session *Session) error {
+	return sg.db.Save(session).Error
+}
+
+func (sg *sessionGorm) Delete(id uint) error {
+	session := Session{Model: gorm.Model{ID: id}}
+	return sg.db.Unscoped().Delete(&session).Error
+}
+
+func (sg *sessionGorm) DeleteByUser(userID uint) error {
+	return sg.db.Unscoped().Where("user_id = ?", userID).Delete(Session{}).Error
+}
+
+func (sg *sessionGorm) DeleteExpired() error {
+	return sg.db.Unscoped().Where("expires_at < ?", time.Now()).Delete(Session{}).Error
+}
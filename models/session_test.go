@@ -0,0 +1,179 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"profile.com/hash"
+)
+
+// memorySessions keeps sessions by token hash
+type memorySessions struct {
+	SessionDB
+	byHash map[string]*Session
+}
+
+func (ms *memorySessions) ByToken(tokenHash string) (*Session, error) {
+	s, ok := ms.byHash[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *s
+	return &found, nil
+}
+
+func (ms *memorySessions) Update(session *Session) error {
+	for h, s := range ms.byHash {
+		if s.ID == session.ID {
+			delete(ms.byHash, h)
+		}
+	}
+	ms.byHash[session.TokenHash] = session
+	return nil
+}
+
+// memoryAPITokens keeps API tokens by token hash
+type memoryAPITokens struct {
+	APITokenDB
+	byHash map[string]*APIToken
+}
+
+func (mt *memoryAPITokens) ByToken(tokenHash string) (*APIToken, error) {
+	at, ok := mt.byHash[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *at
+	return &found, nil
+}
+
+func (mt *memoryAPITokens) Update(token *APIToken) error {
+	for h, at := range mt.byHash {
+		if at.ID == token.ID {
+			delete(mt.byHash, h)
+		}
+	}
+	mt.byHash[token.TokenHash] = token
+	return nil
+}
+
+// rotationStore stores records by token hash for the rotation test
+type rotationStore interface {
+	// add stores a record for token hashed with h
+	add(id uint, token string, h hash.HMAC)
+	// lookup finds the record of token through the validation layer
+	lookup(token string, h hash.HMAC) (uint, error)
+	// hashOf returns the stored hash of the record with id
+	hashOf(id uint) string
+}
+
+type sessionStore struct{ db *memorySessions }
+
+func (s sessionStore) add(id uint, token string, h hash.HMAC) {
+	session := &Session{UserID: 1, TokenHash: h.Hash(token), ExpiresAt: time.Now().Add(time.Hour)}
+	session.ID = id
+	s.db.byHash[session.TokenHash] = session
+}
+
+func (s sessionStore) lookup(token string, h hash.HMAC) (uint, error) {
+	found, err := (&sessionValidation{SessionDB: s.db, hmac: h}).ByToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return found.ID, nil
+}
+
+func (s sessionStore) hashOf(id uint) string {
+	for h, session := range s.db.byHash {
+		if session.ID == id {
+			return h
+		}
+	}
+	return ""
+}
+
+type apiTokenStore struct{ db *memoryAPITokens }
+
+func (s apiTokenStore) add(id uint, token string, h hash.HMAC) {
+	at := &APIToken{UserID: 1, Name: "cli", TokenHash: h.Hash(token)}
+	at.ID = id
+	s.db.byHash[at.TokenHash] = at
+}
+
+func (s apiTokenStore) lookup(token string, h hash.HMAC) (uint, error) {
+	found, err := (&apiTokenValidation{APITokenDB: s.db, hmac: h}).ByToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return found.ID, nil
+}
+
+func (s apiTokenStore) hashOf(id uint) string {
+	for h, at := range s.db.byHash {
+		if at.ID == id {
+			return h
+		}
+	}
+	return ""
+}
+
+// TestTokensSurviveKeyRotation rotates the HMAC key under stored sessions
+// and API tokens. A token used during the grace period is moved onto the
+// new key and keeps working once the old key is retired, one that was not
+// used in time stops working
+func TestTokensSurviveKeyRotation(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func() rotationStore
+	}{
+		{"sessions", func() rotationStore {
+			return sessionStore{&memorySessions{byHash: map[string]*Session{}}}
+		}},
+		{"api tokens", func() rotationStore {
+			return apiTokenStore{&memoryAPITokens{byHash: map[string]*APIToken{}}}
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := tc.store()
+			kr := hash.NewKeyring("legacy-secret")
+			before, err := kr.HMAC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.add(1, "used-token", before)
+			store.add(2, "idle-token", before)
+
+			if _, err := kr.Rotate(time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			during, err := kr.HMAC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id, err := store.lookup("used-token", during); err != nil || id != 1 {
+				t.Fatalf("lookup during grace = %d, %v, want record 1", id, err)
+			}
+			if got, want := store.hashOf(1), during.Hash("used-token"); got != want {
+				t.Errorf("record 1 was not rehashed onto the active key")
+			}
+			if got, want := store.hashOf(2), before.Hash("idle-token"); got != want {
+				t.Errorf("record 2 was rehashed without being looked up")
+			}
+
+			if err := kr.Retire(hash.LegacyKeyID); err != nil {
+				t.Fatal(err)
+			}
+			after, err := kr.HMAC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id, err := store.lookup("used-token", after); err != nil || id != 1 {
+				t.Errorf("rehashed token after retiring the old key = %d, %v, want record 1", id, err)
+			}
+			if _, err := store.lookup("idle-token", after); err != ErrNotFound {
+				t.Errorf("token hashed with the retired key: error = %v, want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// SkillLevelBeginner is the lowest proficiency level
+	SkillLevelBeginner = iota + 1
+	// SkillLevelIntermediate is the second proficiency level
+	SkillLevelIntermediate
+	// SkillLevelAdvanced is the third proficiency level
+	SkillLevelAdvanced
+	// SkillLevelExpert is the highest proficiency level
+	SkillLevelExpert
+)
+
+// SkillLevels maps each proficiency level to its display name, the zero
+// value meaning the user did not say
+var SkillLevels = []string{"Unspecified", "Beginner", "Intermediate", "Advanced", "Expert"}
+
+// maxSkillYears caps years of experience at something believable
+const maxSkillYears = 60
+
+// Skill defines the shape of the skill db, the shared taxonomy every
+// user's skills point at
+type Skill struct {
+	gorm.Model
+	Name string `gorm:"not null"`
+	Slug string `gorm:"not null;unique_index"`
+}
+
+// SkillAlias defines the shape of the skill alias db
+type SkillAlias struct {
+	gorm.Model
+	Alias   string `gorm:"not null;unique_index"`
+	SkillID uint   `gorm:"not null;index"`
+}
+
+// UserSkill defines the shape of the user skill db, joining users to skills
+type UserSkill struct {
+	gorm.Model
+	UserID   uint  `gorm:"not null;unique_index:idx_user_skill"`
+	SkillID  uint  `gorm:"not null;unique_index:idx_user_skill"`
+	Skill    Skill `gorm:"association_autoupdate:false;association_autocreate:false"`
+	Level    int   `gorm:"not null;default:0"`
+	Years    int   `gorm:"not null;default:0"`
+	Position int   `gorm:"not null"`
+}
+
+// LevelName returns the display name of the proficiency level
+func (us *UserSkill) LevelName() string {
+	if us.Level < 0 || us.Level >= len(SkillLevels) {
+		return SkillLevels[0]
+	}
+	return SkillLevels[us.Level]
+}
+
+// SplitSkills splits a comma separated list of skills, dropping blanks
+func SplitSkills(skills string) []string {
+	var names []string
+	for _, name := range strings.Split(skills, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// skillSlug is the case and whitespace insensitive key of a skill name
+func skillSlug(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// SkillDB defines the shape of the skill db interface
+type SkillDB interface {
+	BySlug(slug string) (*Skill, error)
+	ByAlias(alias string) (*Skill, error)
+	Create(skill *Skill) error
+	CreateAlias(alias *SkillAlias) error
+	Suggest(query string, limit int) ([]Skill, error)
+
+	UserSkillByID(id uint) (*UserSkill, error)
+	UserSkills(userID uint) ([]UserSkill, error)
+	CreateUserSkill(us *UserSkill) error
+	UpdateUserSkill(us *UserSkill) error
+	DeleteUserSkill(id uint) error
+}
+
+// SkillService defines the shape of the skill service
+type SkillService interface {
+	Canonicalize(name string) (*Skill, error)
+	AddUserSkill(user *User, name string, level, years int) (*UserSkill, error)
+	RemoveUserSkill(user *User, id uint) error
+	SetUserSkills(user *User, names []string) error
+	SkillDB
+}
+
+type skillService struct {
+	SkillDB
+	us UserService
+}
+type skillValidation struct {
+	SkillDB
+}
+type skillGorm struct {
+	db *gorm.DB
+}
+
+// NewSkillService returns the skill service struct
+func NewSkillService(db *gorm.DB, us UserService) SkillService {
+	sg := newSkillGorm(db)
+	sv := newSkillValidation(sg)
+	return &skillService{
+		SkillDB: sv,
+		us:      us,
+	}
+}
+
+func newSkillValidation(sg *skillGorm) *skillValidation {
+	return &skillValidation{
+		SkillDB: sg,
+	}
+}
+
+func newSkillGorm(db *gorm.DB) *skillGorm {
+	return &skillGorm{
+		db: db,
+	}
+}
+
+// ##################### Skill Service ################################ //
+
+// Canonicalize maps a skill name typed by a user to the shared skill,
+// following aliases and creating the skill when it is new
+func (ss *skillService) Canonicalize(name string) (*Skill, error) {
+	slug := skillSlug(name)
+	if slug == "" {
+		return nil, ErrSkillNameMissing
+	}
+	if skill, err := ss.SkillDB.ByAlias(slug); err == nil {
+		return skill, nil
+	}
+	if skill, err := ss.SkillDB.BySlug(slug); err == nil {
+		return skill, nil
+	}
+	skill := Skill{
+		Name: strings.Join(strings.Fields(name), " "),
+	}
+	if err := ss.SkillDB.Create(&skill); err != nil {
+		return nil, err
+	}
+	return &skill, nil
+}
+
+// AddUserSkill adds a skill to the user, or updates the level and years
+// when they already have it
+func (ss *skillService) AddUserSkill(user *User, name string, level, years int) (*UserSkill, error) {
+	skill, err := ss.Canonicalize(name)
+	if err != nil {
+		return nil, err
+	}
+	current, err := ss.SkillDB.UserSkills(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range current {
+		if current[i].SkillID == skill.ID {
+			current[i].Level = level
+			current[i].Years = years
+			if err := ss.SkillDB.UpdateUserSkill(&current[i]); err != nil {
+				return nil, err
+			}
+			return &current[i], nil
+		}
+	}
+	us := UserSkill{
+		UserID:   user.ID,
+		SkillID:  skill.ID,
+		Skill:    *skill,
+		Level:    level,
+		Years:    years,
+		Position: len(current),
+	}
+	if err := ss.SkillDB.CreateUserSkill(&us); err != nil {
+		return nil, err
+	}
+	return &us, ss.syncUserSkills(user)
+}
+
+// RemoveUserSkill removes one of the user's skills
+func (ss *skillService) RemoveUserSkill(user *User, id uint) error {
+	us, err := ss.SkillDB.UserSkillByID(id)
+	if err != nil || us.UserID != user.ID {
+		return ErrNotFound
+	}
+	if err := ss.SkillDB.DeleteUserSkill(id); err != nil {
+		return err
+	}
+	return ss.syncUserSkills(user)
+}
+
+// SetUserSkills replaces the user's skills with names in that order,
+// keeping the level and years of skills they already had
+func (ss *skillService) SetUserSkills(user *User, names []string) error {
+	current, err := ss.SkillDB.UserSkills(user.ID)
+	if err != nil {
+		return err
+	}
+	existing := make(map[uint]*UserSkill, len(current))
+	for i := range current {
+		existing[current[i].SkillID] = &current[i]
+	}
+
+	keep := map[uint]bool{}
+	position := 0
+	for _, name := range names {
+		skill, err := ss.Canonicalize(name)
+		if err != nil {
+			return err
+		}
+		if keep[skill.ID] {
+			continue
+		}
+		keep[skill.ID] = true
+		if us, ok := existing[skill.ID]; ok {
+			us.Position = position
+			if err := ss.SkillDB.UpdateUserSkill(us); err != nil {
+				return err
+			}
+		} else {
+			us := UserSkill{
+				UserID:   user.ID,
+				SkillID:  skill.ID,
+				Position: position,
+			}
+			if err := ss.SkillDB.CreateUserSkill(&us); err != nil {
+				return err
+			}
+		}
+		position++
+	}
+	for _, us := range current {
+		if !keep[us.SkillID] {
+			if err := ss.SkillDB.DeleteUserSkill(us.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return ss.syncUserSkills(user)
+}
+
+// syncUserSkills writes the canonical skill names back to User.Skills,
+// which is kept as a denormalized copy for search and display
+func (ss *skillService) syncUserSkills(user *User) error {
+	skills, err := ss.SkillDB.UserSkills(user.ID)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(skills))
+	for _, us := range skills {
+		names = append(names, us.Skill.Name)
+	}
+	user.Skills = strings.Join(names, ", ")
+	return ss.us.Update(user)
+}
+
+// ##################### Skill Validation ################################ //
+
+type skillValFn func(skill *Skill) error
+
+func runSkillValFns(skill *Skill, fns ...skillValFn) error {
+	for _, fn := range fns {
+		if err := fn(skill); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sv *skillValidation) checkForName(skill *Skill) error {
+	skill.Name = strings.TrimSpace(skill.Name)
+	if skill.Name == "" {
+		return ErrSkillNameMissing
+	}
+	return nil
+}
+
+func (sv *skillValidation) setSlug(skill *Skill) error {
+	skill.Slug = skillSlug(skill.Name)
+	return nil
+}
+
+type userSkillValFn func(us *UserSkill) error
+
+func runUserSkillValFns(us *UserSkill, fns ...userSkillValFn) error {
+	for _, fn := range fns {
+		if err := fn(us); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sv *skillValidation) checkForUserID(us *UserSkill) error {
+	if us.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (sv *skillValidation) checkForSkillID(us *UserSkill) error {
+	if us.SkillID == 0 {
+		return ErrSkillNameMissing
+	}
+	return nil
+}
+
+func (sv *skillValidation) checkLevel(us *UserSkill) error {
+	if us.Level < 0 || us.Level > SkillLevelExpert {
+		return ErrSkillLevelInvalid
+	}
+	return nil
+}
+
+func (sv *skillValidation) checkYears(us *UserSkill) error {
+	if us.Years < 0 || us.Years > maxSkillYears {
+		return ErrSkillYearsInvalid
+	}
+	return nil
+}
+
+func (sv *skillValidation) BySlug(slug string) (*Skill, error) {
+	return sv.SkillDB.BySlug(skillSlug(slug))
+}
+
+func (sv *skillValidation) ByAlias(alias string) (*Skill, error) {
+	return sv.SkillDB.ByAlias(skillSlug(alias))
+}
+
+func (sv *skillValidation) Create(skill *Skill) error {
+	if err := runSkillValFns(skill,
+		sv.checkForName,
+		sv.setSlug,
+	); err != nil {
+		return err
+	}
+	return sv.SkillDB.Create(skill)
+}
+
+func (sv *skillValidation) CreateAlias(alias *SkillAlias) error {
+	alias.Alias = skillSlug(alias.Alias)
+	if alias.Alias == "" || alias.SkillID == 0 {
+		return ErrSkillNameMissing
+	}
+	return sv.SkillDB.CreateAlias(alias)
+}
+
+func (sv *skillValidation) Suggest(query string, limit int) ([]Skill, error) {
+	query = skillSlug(query)
+	if query == "" {
+		return []Skill{}, nil
+	}
+	if limit <= 0 || limit > 20 {
+		limit = 10
+	}
+	return sv.SkillDB.Suggest(query, limit)
+}
+
+func (sv *skillValidation) UserSkills(userID uint) ([]UserSkill, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return sv.SkillDB.UserSkills(userID)
+}
+
+func (sv *skillValidation) CreateUserSkill(us *UserSkill) error {
+	if err := runUserSkillValFns(us,
+		sv.checkForUserID,
+		sv.checkForSkillID,
+		sv.checkLevel,
+		sv.checkYears,
+	); err != nil {
+		return err
+	}
+	return sv.SkillDB.CreateUserSkill(us)
+}
+
+func (sv *skillValidation) UpdateUserSkill(us *UserSkill) error {
+	if err := runUserSkillValFns(us,
+		sv.checkForUserID,
+		sv.checkForSkillID,
+		sv.checkLevel,
+		sv.checkYears,
+	); err != nil {
+		return err
+	}
+	return sv.SkillDB.UpdateUserSkill(us)
+}
+
+func (sv *skillValidation) DeleteUserSkill(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return sv.SkillDB.DeleteUserSkill(id)
+}
+
+// ##################### Skill Gorm ################################ //
+
+func (sg *skillGorm) BySlug(slug string) (*Skill, error) {
+	var skill Skill
+	if err := sg.db.Where("slug = ?", slug).First(&skill).Error; err != nil {
+		return nil, err
+	}
+	return &skill, nil
+}
+
+func (sg *skillGorm) ByAlias(alias string) (*Skill, error) {
+	var skill Skill
+	err := sg.db.Joins("JOIN skill_aliases ON skill_aliases.skill_id = skills.id").
+		Where("skill_aliases.alias = ?", alias).First(&skill).Error
+	if err != nil {
+		return nil, err
+	}
+	return &skill, nil
+}
+
+func (sg *skillGorm) Create(skill *Skill) error {
+	return sg.db.Create(skill).Error
+}
+
+func (sg *skillGorm) CreateAlias(alias *SkillAlias) error {
+	return sg.db.Create(alias).Error
+}
+
+// Suggest returns skills whose name or alias starts with query, the most
+// used skills first
+func (sg *skillGorm) Suggest(query string, limit int) ([]Skill, error) {
+	var skills []Skill
+	like := strings.NewReplacer("%", `\%`, "_", `\_`).Replace(query) + "%"
+	err := sg.db.
+		Where("skills.slug LIKE ? OR skills.id IN (SELECT skill_id FROM skill_aliases WHERE alias LIKE ?)", like, like).
+		Order("(SELECT COUNT(*) FROM user_skills WHERE user_skills.skill_id = skills.id AND user_skills.deleted_at IS NULL) DESC, skills.name ASC").
+		Limit(limit).Find(&skills).Error
+	if err != nil {
+		return nil, err
+	}
+	return skills, nil
+}
+
+func (sg *skillGorm) UserSkillByID(id uint) (*UserSkill, error) {
+	var us UserSkill
+	if err := sg.db.Preload("Skill").Where("id = ?", id).First(&us).Error; err != nil {
+		return nil, err
+	}
+	return &us, nil
+}
+
+func (sg *skillGorm) UserSkills(userID uint) ([]UserSkill, error) {
+	var skills []UserSkill
+	err := sg.db.Preload("Skill").Where("user_id = ?", userID).Order("position asc").Find(&skills).Error
+	if err != nil {
+		return nil, err
+	}
+	return skills, nil
+}
+
+func (sg *skillGorm) CreateUserSkill(us *UserSkill) error {
+	return sg.db.Create(us).Error
+}
+
+func (sg *skillGorm) UpdateUserSkill(us *UserSkill) error {
+	return sg.db.Save(us).Error
+}
+
+func (sg *skillGorm) DeleteUserSkill(id uint) error {
+	us := UserSkill{Model: gorm.Model{ID: id}}
+	return sg.db.Unscoped().Delete(&us).Error
+}
@@ -0,0 +1,411 @@
+package models
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+	"profile.com/totp"
+)
+
+const (
+	// TwoFactorIssuer is the name shown in authenticator apps
+	TwoFactorIssuer = "Profile"
+	// TwoFactorPendingExpiry is how long a user has to enter their code
+	// after giving a correct password
+	TwoFactorPendingExpiry = 5 * time.Minute
+	// recoveryCodeCount is the number of recovery codes issued at once
+	recoveryCodeCount = 10
+	// recoveryCodeBytes is the number of random bytes in a recovery code
+	recoveryCodeBytes = 5
+)
+
+// RecoveryCode defines the shape of the recovery code db
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index"`
+	Code     string `gorm:"-"`
+	CodeHash string `gorm:"not null;unique_index"`
+}
+
+// RecoveryCodeDB defines the shape of the recovery code db interface
+type RecoveryCodeDB interface {
+	Create(rc *RecoveryCode) error
+	ByCode(userID uint, code string) (*RecoveryCode, error)
+	Delete(id uint) error
+	DeleteByUser(userID uint) error
+}
+
+// TwoFactorService defines the shape of the two factor service
+type TwoFactorService interface {
+	Enroll(user *User) (string, error)
+	Enable(user *User, code string) ([]string, error)
+	Disable(user *User, code string) error
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+	Verify(user *User, code string) error
+	PendingToken(user *User) (string, error)
+	VerifyPending(token, code string) (*User, error)
+}
+
+type twoFactorService struct {
+	RecoveryCodeDB
+	challenges TwoFactorChallengeDB
+	us         UserService
+	limiter    RateLimiter
+}
+type recoveryCodeValidation struct {
+	RecoveryCodeDB
+	hmac hash.HMAC
+}
+type recoveryCodeGorm struct {
+	db *gorm.DB
+}
+
+// NewTwoFactorService returns the two factor service struct, limiter
+// throttles wrong codes per user across every pending login
+func NewTwoFactorService(db *gorm.DB, us UserService, hmac hash.HMAC, limiter RateLimiter) TwoFactorService {
+	rcg := newRecoveryCodeGorm(db)
+	rcv := newRecoveryCodeValidation(rcg, hmac)
+	tfcg := newTwoFactorChallengeGorm(db)
+	tfcv := newTwoFactorChallengeValidation(tfcg, hmac)
+	return &twoFactorService{
+		RecoveryCodeDB: rcv,
+		challenges:     tfcv,
+		us:             us,
+		limiter:        limiter,
+	}
+}
+
+func newRecoveryCodeValidation(rcg *recoveryCodeGorm, hmac hash.HMAC) *recoveryCodeValidation {
+	return &recoveryCodeValidation{
+		hmac:           hmac,
+		RecoveryCodeDB: rcg,
+	}
+}
+
+func newRecoveryCodeGorm(db *gorm.DB) *recoveryCodeGorm {
+	return &recoveryCodeGorm{
+		db: db,
+	}
+}
+
+// ##################### Two Factor Service ################################ //
+
+// Enroll generates a new TOTP secret for the user. The secret is saved
+// but two factor stays off until Enable is called with a valid code
+func (tfs *twoFactorService) Enroll(user *User) (string, error) {
+	if user.TOTPEnabled {
+		return "", ErrTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	user.TOTPSecret = secret
+	if err := tfs.us.Update(user); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Enable turns on two factor once the user proves their app is set up,
+// returning a fresh set of recovery codes
+func (tfs *twoFactorService) Enable(user *User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	step, ok := totp.Match(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	if err := tfs.us.Update(user); err != nil {
+		return nil, err
+	}
+	return tfs.newRecoveryCodes(user)
+}
+
+// Disable turns off two factor and removes the secret and recovery codes
+func (tfs *twoFactorService) Disable(user *User, code string) error {
+	if err := tfs.Verify(user, code); err != nil {
+		return err
+	}
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	if err := tfs.us.Update(user); err != nil {
+		return err
+	}
+	return tfs.RecoveryCodeDB.DeleteByUser(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code the user has.
+// Wrong codes are throttled per user
+func (tfs *twoFactorService) RegenerateRecoveryCodes(user *User, code string) ([]string, error) {
+	err := tfs.throttle(user, func() error {
+		return tfs.verifyTOTP(user, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tfs.newRecoveryCodes(user)
+}
+
+// Verify checks a TOTP code, falling back to a recovery code which is
+// used up on success. Wrong codes are throttled per user
+func (tfs *twoFactorService) Verify(user *User, code string) error {
+	return tfs.throttle(user, func() error {
+		return tfs.verifyCode(user, code)
+	})
+}
+
+func (tfs *twoFactorService) verifyCode(user *User, code string) error {
+	if err := tfs.verifyTOTP(user, code); err != ErrTwoFactorCodeInvalid {
+		return err
+	}
+	rc, err := tfs.RecoveryCodeDB.ByCode(user.ID, code)
+	if err != nil {
+		return ErrTwoFactorCodeInvalid
+	}
+	return tfs.RecoveryCodeDB.Delete(rc.ID)
+}
+
+// PendingToken starts a short lived challenge proving the user got past
+// the password step of login, replacing any earlier one, and returns
+// its token
+func (tfs *twoFactorService) PendingToken(user *User) (string, error) {
+	if err := tfs.challenges.DeleteByUser(user.ID); err != nil {
+		return "", err
+	}
+	tfc := TwoFactorChallenge{
+		UserID: user.ID,
+	}
+	if err := tfs.challenges.Create(&tfc); err != nil {
+		return "", err
+	}
+	return tfc.Token, nil
+}
+
+// VerifyPending checks a code against the challenge of token and returns
+// the user on success, ending the challenge. A challenge is ended after a
+// few wrong codes so the password has to be given again
+func (tfs *twoFactorService) VerifyPending(token, code string) (*User, error) {
+	tfc, err := tfs.challenges.ByToken(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().After(tfc.ExpiresAt) || tfc.Failures >= twoFactorChallengeMaxFailures {
+		tfs.challenges.DeleteByUser(tfc.UserID)
+		return nil, ErrTokenInvalid
+	}
+	user, err := tfs.us.ByID(tfc.UserID)
+	if err != nil {
+		return nil, err
+	}
+	switch err := tfs.Verify(user, code); err {
+	case nil:
+	case ErrTwoFactorCodeInvalid:
+		failures, err := tfs.challenges.Fail(tfc.ID)
+		if err != nil {
+			return nil, err
+		}
+		if failures >= twoFactorChallengeMaxFailures {
+			tfs.challenges.DeleteByUser(user.ID)
+			return nil, ErrTwoFactorChallengeFailed
+		}
+		return nil, ErrTwoFactorCodeInvalid
+	default:
+		return nil, err
+	}
+	if err := tfs.challenges.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// throttle runs verify under the per user backoff shared by every place
+// a second factor code is checked. Only wrong codes count against it
+func (tfs *twoFactorService) throttle(user *User, verify func() error) error {
+	key := fmt.Sprintf("2fa:%d", user.ID)
+	wait, _, err := tfs.limiter.Attempt(key)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return ErrTooManyAttempts
+	}
+	switch err := verify(); err {
+	case nil:
+		return tfs.limiter.Reset(key)
+	case ErrTwoFactorCodeInvalid:
+		return err
+	default:
+		tfs.limiter.Refund(key)
+		return err
+	}
+}
+
+func (tfs *twoFactorService) verifyTOTP(user *User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+	step, ok := totp.Match(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrTwoFactorCodeInvalid
+	}
+	if err := tfs.us.ClaimTOTPStep(user.ID, step); err != nil {
+		return err
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+func (tfs *twoFactorService) newRecoveryCodes(user *User) ([]string, error) {
+	if err := tfs.RecoveryCodeDB.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		rc := RecoveryCode{
+			UserID: user.ID,
+		}
+		if err := tfs.RecoveryCodeDB.Create(&rc); err != nil {
+			return nil, err
+		}
+		codes = append(codes, rc.Code)
+	}
+	return codes, nil
+}
+
+// ##################### Recovery Code Validation ################################ //
+
+type recoveryCodeValFn func(rc *RecoveryCode) error
+
+func runRecoveryCodeValFns(rc *RecoveryCode, fns ...recoveryCodeValFn) error {
+	for _, fn := range fns {
+		if err := fn(rc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rcv *recoveryCodeValidation) checkForUserID(rc *RecoveryCode) error {
+	if rc.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (rcv *recoveryCodeValidation) generateCode(rc *RecoveryCode) error {
+	if rc.Code != "" {
+		return nil
+	}
+	b, err := rand.Bytes(recoveryCodeBytes)
+	if err != nil {
+		return err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	rc.Code = code[:4] + "-" + code[4:]
+	return nil
+}
+
+// codeHash hashes the code with the user ID so the same code issued to
+// two users never collides, ignoring case and dashes the user types
+func (rcv *recoveryCodeValidation) codeHash(rc *RecoveryCode) error {
+	input := rcv.codeInput(rc)
+	if input == "" {
+		return ErrTwoFactorCodeInvalid
+	}
+	rc.CodeHash = rcv.hmac.Hash(input)
+	return nil
+}
+
+// codeInput is what gets hashed for the code, empty when there is no code
+func (rcv *recoveryCodeValidation) codeInput(rc *RecoveryCode) string {
+	code := strings.ToLower(strings.TrimSpace(rc.Code))
+	code = strings.ReplaceAll(code, "-", "")
+	if code == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s", rc.UserID, code)
+}
+
+func (rcv *recoveryCodeValidation) Create(rc *RecoveryCode) error {
+	if err := runRecoveryCodeValFns(rc,
+		rcv.checkForUserID,
+		rcv.generateCode,
+		rcv.codeHash,
+	); err != nil {
+		return err
+	}
+	return rcv.RecoveryCodeDB.Create(rc)
+}
+
+func (rcv *recoveryCodeValidation) ByCode(userID uint, code string) (*RecoveryCode, error) {
+	rc := &RecoveryCode{
+		UserID: userID,
+		Code:   code,
+	}
+	if err := runRecoveryCodeValFns(rc,
+		rcv.checkForUserID,
+		rcv.codeHash,
+	); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, codeHash := range rcv.hmac.Hashes(rcv.codeInput(rc)) {
+		var found *RecoveryCode
+		if found, err = rcv.RecoveryCodeDB.ByCode(rc.UserID, codeHash); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (rcv *recoveryCodeValidation) Delete(id uint) error {
+	if id == 0 {
+		return ErrIDInvalid
+	}
+	return rcv.RecoveryCodeDB.Delete(id)
+}
+
+func (rcv *recoveryCodeValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return rcv.RecoveryCodeDB.DeleteByUser(userID)
+}
+
+// ##################### Recovery Code Gorm ################################ //
+
+func (rcg *recoveryCodeGorm) Create(rc *RecoveryCode) error {
+	return rcg.db.Create(rc).Error
+}
+
+// ByCode expects the already hashed code
+func (rcg *recoveryCodeGorm) ByCode(userID uint, codeHash string) (*RecoveryCode, error) {
+	var rc RecoveryCode
+	err := rcg.db.Where("user_id = ? AND code_hash = ?", userID, codeHash).First(&rc).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+func (rcg *recoveryCodeGorm) Delete(id uint) error {
+	rc := RecoveryCode{Model: gorm.Model{ID: id}}
+	return rcg.db.Unscoped().Delete(&rc).Error
+}
+
+func (rcg *recoveryCodeGorm) DeleteByUser(userID uint) error {
+	return rcg.db.Unscoped().Where("user_id = ?", userID).Delete(RecoveryCode{}).Error
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/totp"
+)
+
+// claimAnyStep lets every TOTP code through the replay check
+type claimAnyStep struct {
+	UserService
+}
+
+func (claimAnyStep) ClaimTOTPStep(id uint, step int64) error {
+	return nil
+}
+
+// noRecoveryCodes is a user without recovery codes
+type noRecoveryCodes struct {
+	RecoveryCodeDB
+}
+
+func (noRecoveryCodes) ByCode(userID uint, code string) (*RecoveryCode, error) {
+	return nil, ErrNotFound
+}
+
+func TestTwoFactorThrottled(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(tfs TwoFactorService, user *User, code string) error
+	}{
+		{"verify", func(tfs TwoFactorService, user *User, code string) error {
+			return tfs.Verify(user, code)
+		}},
+		{"disable", func(tfs TwoFactorService, user *User, code string) error {
+			return tfs.Disable(user, code)
+		}},
+		{"regenerate recovery codes", func(tfs TwoFactorService, user *User, code string) error {
+			_, err := tfs.RegenerateRecoveryCodes(user, code)
+			return err
+		}},
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tfs := &twoFactorService{
+				RecoveryCodeDB: noRecoveryCodes{},
+				us:             claimAnyStep{},
+				limiter:        NewMemoryRateLimiter(AccountBackoff),
+			}
+			user := &User{Model: gorm.Model{ID: 7}, TOTPEnabled: true, TOTPSecret: secret}
+
+			// a code of the right length that can never match
+			for i := 1; i <= AccountBackoff.Free+1; i++ {
+				if err := tc.check(tfs, user, "12345x"); err != ErrTwoFactorCodeInvalid {
+					t.Fatalf("wrong code %d: error = %v, want %v", i, err, ErrTwoFactorCodeInvalid)
+				}
+			}
+			code, err := totp.Code(secret, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.check(tfs, user, code); err != ErrTooManyAttempts {
+				t.Errorf("right code after %d wrong ones: error = %v, want %v", AccountBackoff.Free+1, err, ErrTooManyAttempts)
+			}
+
+			// other users have their own backoff
+			other := &User{Model: gorm.Model{ID: 8}, TOTPEnabled: true, TOTPSecret: secret}
+			if err := tc.check(tfs, other, "12345x"); err != ErrTwoFactorCodeInvalid {
+				t.Errorf("other user: error = %v, want %v", err, ErrTwoFactorCodeInvalid)
+			}
+		})
+	}
+}
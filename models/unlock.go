@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+// AccountUnlockExpiry is how long an unlock link stays valid, it outlives
+// the lockout so a late click still works
+const AccountUnlockExpiry = 24 * time.Hour
+
+// AccountUnlock defines the shape of the account unlock db
+type AccountUnlock struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	Token     string    `gorm:"-"`
+	TokenHash string    `gorm:"not null;unique_index"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// AccountUnlockDB defines the shape of the account unlock db interface
+type AccountUnlockDB interface {
+	Create(au *AccountUnlock) error
+	ByToken(token string) (*AccountUnlock, error)
+	DeleteByUser(userID uint) error
+}
+
+type accountUnlockValidation struct {
+	AccountUnlockDB
+	hmac hash.HMAC
+}
+type accountUnlockGorm struct {
+	db *gorm.DB
+}
+
+func newAccountUnlockValidation(aug *accountUnlockGorm, hmac hash.HMAC) *accountUnlockValidation {
+	return &accountUnlockValidation{
+		hmac:            hmac,
+		AccountUnlockDB: aug,
+	}
+}
+
+func newAccountUnlockGorm(db *gorm.DB) *accountUnlockGorm {
+	return &accountUnlockGorm{
+		db: db,
+	}
+}
+
+// ##################### Account Unlock Validation ################################ //
+
+type accountUnlockValFn func(au *AccountUnlock) error
+
+func runAccountUnlockValFns(au *AccountUnlock, fns ...accountUnlockValFn) error {
+	for _, fn := range fns {
+		if err := fn(au); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (auv *accountUnlockValidation) checkForUserID(au *AccountUnlock) error {
+	if au.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (auv *accountUnlockValidation) generateToken(au *AccountUnlock) error {
+	if au.Token != "" {
+		return nil
+	}
+	token, err := rand.String(rand.RememberTokenBytes)
+	if err != nil {
+		return err
+	}
+	au.Token = token
+	return nil
+}
+
+func (auv *accountUnlockValidation) tokenHash(au *AccountUnlock) error {
+	if au.Token == "" {
+		return ErrTokenInvalid
+	}
+	au.TokenHash = auv.hmac.Hash(au.Token)
+	return nil
+}
+
+func (auv *accountUnlockValidation) setExpiry(au *AccountUnlock) error {
+	if au.ExpiresAt.IsZero() {
+		au.ExpiresAt = time.Now().Add(AccountUnlockExpiry)
+	}
+	return nil
+}
+
+func (auv *accountUnlockValidation) Create(au *AccountUnlock) error {
+	if err := runAccountUnlockValFns(au,
+		auv.checkForUserID,
+		auv.generateToken,
+		auv.tokenHash,
+		auv.setExpiry,
+	); err != nil {
+		return err
+	}
+	return auv.AccountUnlockDB.Create(au)
+}
+
+func (auv *accountUnlockValidation) ByToken(token string) (*AccountUnlock, error) {
+	au := &AccountUnlock{
+		Token: token,
+	}
+	if err := runAccountUnlockValFns(au, auv.tokenHash); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range auv.hmac.Hashes(au.Token) {
+		var found *AccountUnlock
+		if found, err = auv.AccountUnlockDB.ByToken(tokenHash); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (auv *accountUnlockValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return auv.AccountUnlockDB.DeleteByUser(userID)
+}
+
+// ##################### Account Unlock Gorm ################################ //
+
+func (aug *accountUnlockGorm) Create(au *AccountUnlock) error {
+	return aug.db.Create(au).Error
+}
+
+// ByToken expects the already hashed token
+func (aug *accountUnlockGorm) ByToken(tokenHash string) (*AccountUnlock, error) {
+	var au AccountUnlock
+	if err := aug.db.Where("token_hash = ?", tokenHash).First(&au).Error; err != nil {
+		return nil, err
+	}
+	return &au, nil
+}
+
+func (aug *accountUnlockGorm) DeleteByUser(userID uint) error {
+	return aug.db.Unscoped().Where("user_id = ?", userID).Delete(AccountUnlock{}).Error
+}
@@ -3,13 +3,11 @@ package models
 import (
 	"errors"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
+	"time"
 
 	"github.com/jinzhu/gorm"
 
 	"profile.com/hash"
-	"profile.com/rand"
 )
 
 var (
@@ -21,46 +19,115 @@ var (
 	ErrEmailMissing = errors.New("models: Please input your email")
 	// ErrEmailTaken is returned when email is already in use
 	ErrEmailTaken = errors.New("models: This email is already in use")
-	// ErrInvalidCredentials is returned after an invalid login attempt
-	ErrInvalidCredentials = errors.New("models: Invalid login credentials")
+	// ErrInvalidCredentials is returned after an invalid login attempt, whether
+	// the email or the password was wrong
+	ErrInvalidCredentials = errors.New("models: Invalid email or password")
 	// ErrPasswordTooShort is returned when user inputs short password
 	ErrPasswordTooShort = errors.New("models: The password you provided is too short, minimum of 8 characters")
 	// ErrPasswordNotProvided is returned when user doesnt provide a pasword
 	ErrPasswordNotProvided = errors.New("models: Please provide a password")
-	// ErrPasswordInvalid is returned when a user uses an invalid password
-	ErrPasswordInvalid = errors.New("models: Invalid Password, try again")
 	// ErrPasswordHashMissing is returned when a password hash is missing
 	ErrPasswordHashMissing = errors.New("models: No password hash")
-	// ErrRememberMissing is returned when there is no remember field set
+	// ErrRememberMissing is returned when a session has no token set
 	ErrRememberMissing = errors.New("models: Remember is missing")
-)
-
-const (
-	pepper = "secret-user-pepper"
-	key    = "secret-key"
+	// ErrNotFound is returned when a resource cannot be found
+	ErrNotFound = errors.New("models: Resource not found")
+	// ErrIDInvalid is returned when an invalid ID is provided
+	ErrIDInvalid = errors.New("models: ID provided was invalid")
+	// ErrUserIDMissing is returned when a record is not tied to a user
+	ErrUserIDMissing = errors.New("models: User ID is missing")
+	// ErrTokenInvalid is returned when a token is missing, expired or unknown
+	ErrTokenInvalid = errors.New("models: This link is invalid or has expired")
+	// ErrAlreadyVerified is returned when a verified user asks for a new confirmation link
+	ErrAlreadyVerified = errors.New("models: Your email is already verified")
+	// ErrTwoFactorCodeInvalid is returned when a TOTP or recovery code does not match
+	ErrTwoFactorCodeInvalid = errors.New("models: Invalid authentication code, try again")
+	// ErrTwoFactorNotEnrolled is returned when two factor has not been set up
+	ErrTwoFactorNotEnrolled = errors.New("models: Two factor authentication is not set up")
+	// ErrTwoFactorEnabled is returned when two factor is already turned on
+	ErrTwoFactorEnabled = errors.New("models: Two factor authentication is already enabled")
+	// ErrTokenNameMissing is returned when an api token is created without a name
+	ErrTokenNameMissing = errors.New("models: Please give your token a name")
+	// ErrScopeInvalid is returned when an api token has no scopes or an unknown scope
+	ErrScopeInvalid = errors.New("models: Please choose at least one valid scope")
+	// ErrCompanyMissing is returned when experience is added without a company
+	ErrCompanyMissing = errors.New("models: Please provide the company name")
+	// ErrRoleMissing is returned when experience is added without a role
+	ErrRoleMissing = errors.New("models: Please provide your role")
+	// ErrSchoolMissing is returned when education is added without a school
+	ErrSchoolMissing = errors.New("models: Please provide the school name")
+	// ErrProjectNameMissing is returned when a project is added without a name
+	ErrProjectNameMissing = errors.New("models: Please provide the project name")
+	// ErrURLInvalid is returned when a link is not a valid http or https URL
+	ErrURLInvalid = errors.New("models: Please provide a valid URL")
+	// ErrStartDateMissing is returned when a profile section has no start date
+	ErrStartDateMissing = errors.New("models: Please provide a start date")
+	// ErrSkillNameMissing is returned when a skill has no name
+	ErrSkillNameMissing = errors.New("models: Please provide the skill name")
+	// ErrSkillLevelInvalid is returned when a skill level is out of range
+	ErrSkillLevelInvalid = errors.New("models: Please choose a valid skill level")
+	// ErrSkillYearsInvalid is returned when years of experience are out of range
+	ErrSkillYearsInvalid = errors.New("models: Please provide a valid number of years")
+	// ErrUsernameLength is returned when a username is too short or too long
+	ErrUsernameLength = errors.New("models: Usernames must be between 3 and 30 characters")
+	// ErrUsernameInvalid is returned when a username has characters that are not allowed
+	ErrUsernameInvalid = errors.New("models: Usernames may only contain letters, numbers, dashes and underscores")
+	// ErrUsernameTaken is returned when a username is reserved or in use
+	ErrUsernameTaken = errors.New("models: This username is not available")
+	// ErrVisibilityInvalid is returned when a visibility setting is not known
+	ErrVisibilityInvalid = errors.New("models: Visibility must be public, users, link or private")
+	// ErrSortInvalid is returned when results are asked for in an unknown order
+	ErrSortInvalid = errors.New("models: This sort order is not supported")
+	// ErrCursorInvalid is returned when a page cursor cannot be decoded
+	ErrCursorInvalid = errors.New("models: Page cursor is invalid")
+	// ErrAvatarMissing is returned when an avatar upload has no file in it
+	ErrAvatarMissing = errors.New("models: Choose an image to upload")
+	// ErrAvatarTooLarge is returned when an uploaded avatar is too big
+	ErrAvatarTooLarge = errors.New("models: Avatar must be an image under 5MB")
+	// ErrAvatarType is returned when an uploaded avatar is not an image we accept
+	ErrAvatarType = errors.New("models: Avatar must be a JPEG, PNG, GIF or WebP image")
+	// ErrTwoFactorChallengeFailed is returned when a pending login got too many wrong codes
+	ErrTwoFactorChallengeFailed = errors.New("models: Too many wrong codes, please sign in again")
+	// ErrTooManyAttempts is returned when an account or IP has to wait before logging in again
+	ErrTooManyAttempts = errors.New("models: Too many failed login attempts, please try again later")
+	// ErrDateInvalid is returned when a date cannot be understood
+	ErrDateInvalid = errors.New("models: Please provide dates as YYYY-MM")
+	// ErrDateOrder is returned when a profile section ends before it starts
+	ErrDateOrder = errors.New("models: The end date must be after the start date")
 )
 
 // User defines the shape of the user db
 type User struct {
 	gorm.Model
 	Name         string `gorm:"not null"`
+	Username     string
 	Email        string `gorm:"not null;unique_index"`
-	Password     string `gorm:"-"`
-	PasswordHash string `gorm:"not null"`
-	Remember     string `gorm:"not null"`
-	RememberHash string
+	Password     string `gorm:"-" json:"-"`
+	PasswordHash string `gorm:"not null" json:"-"`
 	Title        string
 	Summary      string
 	Skills       string
+	Verified     bool `gorm:"not null;default:false"`
+	VerifiedAt   *time.Time
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"not null;default:false"`
+	// TOTPLastStep is the time step of the last code used, older and
+	// equal steps are refused so a code cannot be replayed
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	Avatar       string
 }
 
 // UserDB defines the shape of the userdb interface
 type UserDB interface {
 	Create(user *User) error
+	ByID(id uint) (*User, error)
 	ByEmail(email string) (*User, error)
+	ByUsername(username string) (*User, error)
+	UsernameRedirect(username string) (uint, error)
 	Update(user *User) error
-	ByRemember(rememberToken string) (*User, error)
-	All() (*[]User, error)
+	UpdatePasswordHash(id uint, passwordHash string) error
+	ClaimTOTPStep(id uint, step int64) error
+	List(opts ListOptions) (*UserList, error)
 }
 
 // UserVal is the user validation interface
@@ -79,26 +146,32 @@ type userService struct {
 }
 type userValidation struct {
 	UserDB
-	hmac hash.HMAC
+	passwords *hash.PasswordHasher
+	dummyHash string
 }
 type userGorm struct {
 	db *gorm.DB
 }
 
-// NewUserService returns the userservice struct
-func NewUserService(db *gorm.DB) UserService {
+// NewUserService returns the userservice struct, passwords hashes and
+// checks the user passwords
+func NewUserService(db *gorm.DB, passwords *hash.PasswordHasher) UserService {
 	ug := newUserGorm(db)
-	uv := newUserValidation(ug)
+	uv := newUserValidation(ug, passwords)
 	return &userService{
 		UserVal: uv,
 	}
 }
 
-func newUserValidation(ug *userGorm) *userValidation {
-	hmac := hash.NewHMAC(key)
+func newUserValidation(ug *userGorm, passwords *hash.PasswordHasher) *userValidation {
+	dummyHash, err := passwords.Hash("dummy password")
+	if err != nil {
+		panic(err)
+	}
 	return &userValidation{
-		hmac:   hmac,
-		UserDB: ug,
+		UserDB:    ug,
+		passwords: passwords,
+		dummyHash: dummyHash,
 	}
 }
 
@@ -172,12 +245,11 @@ func (uv *userValidation) hashPassword(user *User) error {
 	if user.Password == "" {
 		return nil
 	}
-	passwordPepper := user.Password + pepper
-	bytes, err := bcrypt.GenerateFromPassword([]byte(passwordPepper), bcrypt.DefaultCost)
+	passwordHash, err := uv.passwords.Hash(user.Password)
 	if err != nil {
 		return err
 	}
-	user.PasswordHash = string(bytes)
+	user.PasswordHash = passwordHash
 	user.Password = ""
 	return nil
 }
@@ -189,24 +261,6 @@ func (uv *userValidation) checkForPasswordHash(user *User) error {
 	return nil
 }
 
-func (uv *userValidation) generateRemember(user *User) error {
-	token, err := rand.RememberToken()
-	if err != nil {
-		return err
-	}
-	user.Remember = token
-	return nil
-}
-
-func (uv *userValidation) rememberHash(user *User) error {
-	if user.Remember == "" {
-		return ErrRememberMissing
-	}
-	hash := uv.hmac.Hash(user.Remember)
-	user.RememberHash = hash
-	return nil
-}
-
 func (uv *userValidation) Create(user *User) error {
 	if err := runUserValFns(user,
 		uv.checkForName,
@@ -215,10 +269,11 @@ func (uv *userValidation) Create(user *User) error {
 		uv.checkPasswordLength,
 		uv.normalizeEmail,
 		uv.checkDBForEmail,
+		uv.normalizeUsername,
+		uv.checkUsernameFormat,
+		uv.checkUsernameAvailable,
 		uv.hashPassword,
 		uv.checkForPasswordHash,
-		uv.generateRemember,
-		uv.rememberHash,
 	); err != nil {
 		return err
 	}
@@ -243,6 +298,9 @@ func (uv *userValidation) Update(user *User) error {
 		uv.checkForName,
 		uv.checkForEmail,
 		uv.normalizeEmail,
+		uv.normalizeUsername,
+		uv.checkUsernameFormat,
+		uv.checkUsernameAvailable,
 		uv.checkPasswordLength,
 		uv.hashPassword,
 		uv.checkForPasswordHash,
@@ -262,24 +320,40 @@ func (uv *userValidation) Authenticate(user *User) (*User, error) {
 	}
 	u, err := uv.UserDB.ByEmail(user.Email)
 	if err != nil {
+		// Compare anyway so unknown emails take as long as wrong passwords
+		uv.passwords.Compare(uv.dummyHash, user.Password)
 		return nil, ErrInvalidCredentials
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(user.Password+pepper)); err != nil {
-		return nil, ErrPasswordInvalid
+	switch err := uv.passwords.Compare(u.PasswordHash, user.Password); err {
+	case nil:
+	case hash.ErrPasswordMismatch:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, err
 	}
+	uv.upgradePasswordHash(u, user.Password)
 	return u, nil
 }
 
-// ##################### User Gorm ################################ //
-
-func (ug *userGorm) All() (*[]User, error) {
-	users := []User{}
-	if err := ug.db.Find(&users).Error; err != nil {
-		return nil, err
+// upgradePasswordHash rehashes the password of a user who just signed in
+// when their hash uses an outdated algorithm, cost or pepper. The old hash
+// still works, so a failed upgrade is simply tried again next time
+func (uv *userValidation) upgradePasswordHash(user *User, password string) {
+	if !uv.passwords.NeedsRehash(user.PasswordHash) {
+		return
+	}
+	passwordHash, err := uv.passwords.Hash(password)
+	if err != nil {
+		return
 	}
-	return &users, nil
+	if err := uv.UserDB.UpdatePasswordHash(user.ID, passwordHash); err != nil {
+		return
+	}
+	user.PasswordHash = passwordHash
 }
 
+// ##################### User Gorm ################################ //
+
 func (ug *userGorm) Create(user *User) error {
 	if err := ug.db.Create(user).Error; err != nil {
 		return err
@@ -287,6 +361,14 @@ func (ug *userGorm) Create(user *User) error {
 	return nil
 }
 
+func (ug *userGorm) ByID(id uint) (*User, error) {
+	user := &User{}
+	if err := ug.db.Where("id = ?", id).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 func (ug *userGorm) ByEmail(email string) (*User, error) {
 	user := &User{}
 	err := ug.db.Where("email = ?", email).First(user).Error
@@ -296,14 +378,31 @@ func (ug *userGorm) ByEmail(email string) (*User, error) {
 	return user, nil
 }
 
-func (ug *userGorm) ByRemember(rememberToken string) (*User, error) {
-	var user User
-	if err := ug.db.Where("remember = ?", rememberToken).First(&user).Error; err != nil {
-		return nil, err
+// UpdatePasswordHash only writes the password hash, so upgrading it on
+// sign in cannot overwrite other changes to the user
+func (ug *userGorm) UpdatePasswordHash(id uint, passwordHash string) error {
+	return ug.db.Model(&User{}).Where("id = ?", id).Update("password_hash", passwordHash).Error
+}
+
+// ClaimTOTPStep records step as used unless it or a later one already
+// was, in one statement so two requests cannot both use the same code
+func (ug *userGorm) ClaimTOTPStep(id uint, step int64) error {
+	db := ug.db.Model(&User{}).Where("id = ? AND totp_last_step < ?", id, step).
+		UpdateColumn("totp_last_step", step)
+	if db.Error != nil {
+		return db.Error
 	}
-	return &user, nil
+	if db.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+	return nil
 }
 
 func (ug *userGorm) Update(user *User) error {
-	return ug.db.Save(user).Error
+	return ug.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveUsernameRedirect(tx, user); err != nil {
+			return err
+		}
+		return tx.Save(user).Error
+	})
 }
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	// ListSortCreated orders users by when they signed up
+	ListSortCreated = "created"
+	// ListSortUpdated orders users by when they last changed their profile
+	ListSortUpdated = "updated"
+	// ListSortName orders users by name
+	ListSortName = "name"
+
+	// ListLimit is the page size used when none is asked for
+	ListLimit = 20
+	// ListMaxLimit caps the page size
+	ListMaxLimit = 100
+)
+
+// listColumns are the user columns List loads, leaving out the secrets
+const listColumns = "id, created_at, updated_at, deleted_at, name, username, email, title, summary, " +
+	"skills, verified, verified_at, totp_enabled"
+
+// listSortColumns maps each sort to the column it orders by
+var listSortColumns = map[string]string{
+	ListSortCreated: "created_at",
+	ListSortUpdated: "updated_at",
+	ListSortName:    "name",
+}
+
+// ListOptions describes a page of users to list. A page is picked either
+// with Offset or by passing the Cursor of the page before it, which stays
+// stable while users sign up
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Cursor string
+	Sort   string
+	Desc   bool
+	Filter UserFilter
+}
+
+// UserFilter narrows down the users List returns, empty fields match
+// everyone
+type UserFilter struct {
+	Name          string
+	Email         string
+	Verified      *bool
+	HasUsername   bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// UserList is one page of users
+type UserList struct {
+	Users      []User
+	Total      int
+	Limit      int
+	Offset     int
+	NextCursor string
+}
+
+// listCursor is the position of the last user of a page
+type listCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"i"`
+}
+
+// encodeListCursor returns the cursor of the page after user
+func encodeListCursor(opts ListOptions, user *User) string {
+	cursor := listCursor{Sort: opts.Sort, Desc: opts.Desc, ID: user.ID}
+	switch opts.Sort {
+	case ListSortCreated:
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case ListSortUpdated:
+		cursor.Value = user.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case ListSortName:
+		cursor.Value = user.Name
+	}
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeListCursor parses a cursor, it has to have been made for the same
+// sort as opts
+func decodeListCursor(opts ListOptions) (*listCursor, interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, nil, ErrCursorInvalid
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, nil, ErrCursorInvalid
+	}
+	if cursor.Sort != opts.Sort || cursor.Desc != opts.Desc || cursor.ID == 0 {
+		return nil, nil, ErrCursorInvalid
+	}
+	if opts.Sort == ListSortName {
+		return &cursor, cursor.Value, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return nil, nil, ErrCursorInvalid
+	}
+	return &cursor, t, nil
+}
+
+// ##################### User Validation ################################ //
+
+type listValFn func(opts *ListOptions) error
+
+func runListValFns(opts *ListOptions, fns ...listValFn) error {
+	for _, fn := range fns {
+		if err := fn(opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (uv *userValidation) setListLimit(opts *ListOptions) error {
+	if opts.Limit < 1 {
+		opts.Limit = ListLimit
+	}
+	if opts.Limit > ListMaxLimit {
+		opts.Limit = ListMaxLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+	return nil
+}
+
+func (uv *userValidation) checkListSort(opts *ListOptions) error {
+	if opts.Sort == "" {
+		opts.Sort = ListSortCreated
+	}
+	if _, ok := listSortColumns[opts.Sort]; !ok {
+		return ErrSortInvalid
+	}
+	return nil
+}
+
+func (uv *userValidation) checkListCursor(opts *ListOptions) error {
+	if opts.Cursor == "" {
+		return nil
+	}
+	if _, _, err := decodeListCursor(*opts); err != nil {
+		return err
+	}
+	opts.Offset = 0
+	return nil
+}
+
+func (uv *userValidation) normalizeListFilter(opts *ListOptions) error {
+	opts.Filter.Name = strings.TrimSpace(opts.Filter.Name)
+	opts.Filter.Email = strings.ToLower(strings.TrimSpace(opts.Filter.Email))
+	return nil
+}
+
+func (uv *userValidation) List(opts ListOptions) (*UserList, error) {
+	if err := runListValFns(&opts,
+		uv.setListLimit,
+		uv.checkListSort,
+		uv.checkListCursor,
+		uv.normalizeListFilter,
+	); err != nil {
+		return nil, err
+	}
+	return uv.UserDB.List(opts)
+}
+
+// ##################### User Gorm ################################ //
+
+func (ug *userGorm) List(opts ListOptions) (*UserList, error) {
+	db := ug.db.Model(&User{})
+	f := opts.Filter
+	if f.Name != "" {
+		db = db.Where("name ILIKE ?", "%"+escapeLike(f.Name)+"%")
+	}
+	if f.Email != "" {
+		db = db.Where("email = ?", f.Email)
+	}
+	if f.Verified != nil {
+		db = db.Where("verified = ?", *f.Verified)
+	}
+	if f.HasUsername {
+		db = db.Where("username <> ''")
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("created_at > ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *f.CreatedBefore)
+	}
+
+	list := &UserList{Limit: opts.Limit, Offset: opts.Offset}
+	if err := db.Count(&list.Total).Error; err != nil {
+		return nil, err
+	}
+
+	column := listSortColumns[opts.Sort]
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if opts.Cursor != "" {
+		cursor, value, err := decodeListCursor(opts)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("("+column+", id) "+cmp+" (?, ?)", value, cursor.ID)
+	}
+	err := db.Select(listColumns).
+		Order(column + " " + dir).Order("id " + dir).
+		Offset(opts.Offset).Limit(opts.Limit + 1).
+		Find(&list.Users).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Users) > opts.Limit {
+		list.Users = list.Users[:opts.Limit]
+		list.NextCursor = encodeListCursor(opts, &list.Users[opts.Limit-1])
+	}
+	return list, nil
+}
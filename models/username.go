@@ -0,0 +1,137 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// UsernameMinLength is the shortest username allowed
+	UsernameMinLength = 3
+	// UsernameMaxLength is the longest username allowed
+	UsernameMaxLength = 30
+)
+
+// usernameRegex allows letters, digits, dashes and underscores, starting
+// and ending with a letter or digit
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9_-]*[a-zA-Z0-9])?$`)
+
+// reservedUsernames would clash with routes or could be used to
+// impersonate the site
+var reservedUsernames = map[string]bool{
+	"2fa": true, "about": true, "account": true, "admin": true, "administrator": true,
+	"api": true, "assets": true, "avatar": true, "contact": true, "dashboard": true,
+	"devices": true, "forgot": true, "help": true, "home": true, "login": true,
+	"logout": true, "me": true, "people": true, "profile": true, "reset": true,
+	"root": true, "settings": true, "signup": true, "static": true, "support": true,
+	"system": true, "tokens": true, "u": true, "user": true, "users": true,
+	"verify": true, "www": true,
+}
+
+// UsernameRedirect defines the shape of the username redirect db, which
+// keeps old usernames pointing at the user after they rename
+type UsernameRedirect struct {
+	gorm.Model
+	Username string `gorm:"not null;unique_index"`
+	UserID   uint   `gorm:"not null;index"`
+}
+
+// ##################### User Validation ################################ //
+
+func (uv *userValidation) normalizeUsername(user *User) error {
+	user.Username = strings.TrimSpace(user.Username)
+	user.Username = strings.TrimPrefix(user.Username, "@")
+	return nil
+}
+
+func (uv *userValidation) checkUsernameFormat(user *User) error {
+	if user.Username == "" {
+		return nil
+	}
+	if len(user.Username) < UsernameMinLength || len(user.Username) > UsernameMaxLength {
+		return ErrUsernameLength
+	}
+	if !usernameRegex.MatchString(user.Username) {
+		return ErrUsernameInvalid
+	}
+	if reservedUsernames[strings.ToLower(user.Username)] {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// checkUsernameAvailable makes sure no other user has the username now or
+// had it before, so old profile links cannot be taken over
+func (uv *userValidation) checkUsernameAvailable(user *User) error {
+	if user.Username == "" {
+		return nil
+	}
+	if existing, err := uv.UserDB.ByUsername(user.Username); err == nil && existing.ID != user.ID {
+		return ErrUsernameTaken
+	}
+	if userID, err := uv.UserDB.UsernameRedirect(user.Username); err == nil && userID != user.ID {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+func (uv *userValidation) ByUsername(username string) (*User, error) {
+	user := &User{
+		Username: username,
+	}
+	if err := runUserValFns(user, uv.normalizeUsername); err != nil {
+		return nil, err
+	}
+	if user.Username == "" {
+		return nil, ErrNotFound
+	}
+	return uv.UserDB.ByUsername(user.Username)
+}
+
+// ##################### User Gorm ################################ //
+
+func (ug *userGorm) ByUsername(username string) (*User, error) {
+	user := &User{}
+	if err := ug.db.Where("LOWER(username) = LOWER(?)", username).First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UsernameRedirect returns the ID of the user who used to have username
+func (ug *userGorm) UsernameRedirect(username string) (uint, error) {
+	var redirect UsernameRedirect
+	if err := ug.db.Where("username = ?", strings.ToLower(username)).First(&redirect).Error; err != nil {
+		return 0, err
+	}
+	return redirect.UserID, nil
+}
+
+// saveUsernameRedirect remembers the user's old username when it changes
+// and drops any redirect for the name they now use
+func saveUsernameRedirect(tx *gorm.DB, user *User) error {
+	var old User
+	if err := tx.Select("username").Where("id = ?", user.ID).First(&old).Error; err != nil {
+		return err
+	}
+	if strings.EqualFold(old.Username, user.Username) {
+		return nil
+	}
+	if user.Username != "" {
+		err := tx.Unscoped().Where("username = ?", strings.ToLower(user.Username)).Delete(UsernameRedirect{}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if old.Username == "" {
+		return nil
+	}
+	redirect := UsernameRedirect{
+		Username: strings.ToLower(old.Username),
+		UserID:   user.ID,
+	}
+	return tx.Where(UsernameRedirect{Username: redirect.Username}).Assign(UsernameRedirect{UserID: user.ID}).
+		FirstOrCreate(&redirect).Error
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/hash"
+	"profile.com/rand"
+)
+
+// EmailVerificationExpiry is how long an email confirmation link stays valid
+const EmailVerificationExpiry = 72 * time.Hour
+
+// EmailVerification defines the shape of the email verification db
+type EmailVerification struct {
+	gorm.Model
+	UserID    uint      `gorm:"not null;index"`
+	Token     string    `gorm:"-"`
+	TokenHash string    `gorm:"not null;unique_index"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// EmailVerificationDB defines the shape of the email verification db interface
+type EmailVerificationDB interface {
+	Create(ev *EmailVerification) error
+	ByToken(token string) (*EmailVerification, error)
+	DeleteByUser(userID uint) error
+}
+
+// EmailVerificationService defines the shape of the email verification service
+type EmailVerificationService interface {
+	Initiate(user *User) (string, error)
+	Complete(token string) (*User, error)
+}
+
+type emailVerificationService struct {
+	EmailVerificationDB
+	us UserService
+}
+type emailVerificationValidation struct {
+	EmailVerificationDB
+	hmac hash.HMAC
+}
+type emailVerificationGorm struct {
+	db *gorm.DB
+}
+
+// NewEmailVerificationService returns the email verification service struct
+func NewEmailVerificationService(db *gorm.DB, us UserService, hmac hash.HMAC) EmailVerificationService {
+	evg := newEmailVerificationGorm(db)
+	evv := newEmailVerificationValidation(evg, hmac)
+	return &emailVerificationService{
+		EmailVerificationDB: evv,
+		us:                  us,
+	}
+}
+
+func newEmailVerificationValidation(evg *emailVerificationGorm, hmac hash.HMAC) *emailVerificationValidation {
+	return &emailVerificationValidation{
+		hmac:                hmac,
+		EmailVerificationDB: evg,
+	}
+}
+
+func newEmailVerificationGorm(db *gorm.DB) *emailVerificationGorm {
+	return &emailVerificationGorm{
+		db: db,
+	}
+}
+
+// ##################### Email Verification Service ################################ //
+
+// Initiate issues a new confirmation token for the user, replacing any
+// token that was sent before
+func (evs *emailVerificationService) Initiate(user *User) (string, error) {
+	if user.Verified {
+		return "", ErrAlreadyVerified
+	}
+	if err := evs.EmailVerificationDB.DeleteByUser(user.ID); err != nil {
+		return "", err
+	}
+	ev := EmailVerification{
+		UserID: user.ID,
+	}
+	if err := evs.EmailVerificationDB.Create(&ev); err != nil {
+		return "", err
+	}
+	return ev.Token, nil
+}
+
+// Complete marks the owner of the token as verified
+func (evs *emailVerificationService) Complete(token string) (*User, error) {
+	ev, err := evs.EmailVerificationDB.ByToken(token)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if time.Now().After(ev.ExpiresAt) {
+		evs.EmailVerificationDB.DeleteByUser(ev.UserID)
+		return nil, ErrTokenInvalid
+	}
+	user, err := evs.us.ByID(ev.UserID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user.Verified = true
+	user.VerifiedAt = &now
+	if err := evs.us.Update(user); err != nil {
+		return nil, err
+	}
+	if err := evs.EmailVerificationDB.DeleteByUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ##################### Email Verification Validation ################################ //
+
+type emailVerificationValFn func(ev *EmailVerification) error
+
+func runEmailVerificationValFns(ev *EmailVerification, fns ...emailVerificationValFn) error {
+	for _, fn := range fns {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (evv *emailVerificationValidation) checkForUserID(ev *EmailVerification) error {
+	if ev.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (evv *emailVerificationValidation) generateToken(ev *EmailVerification) error {
+	if ev.Token != "" {
+		return nil
+	}
+	token, err := rand.String(rand.RememberTokenBytes)
+	if err != nil {
+		return err
+	}
+	ev.Token = token
+	return nil
+}
+
+func (evv *emailVerificationValidation) tokenHash(ev *EmailVerification) error {
+	if ev.Token == "" {
+		return ErrTokenInvalid
+	}
+	ev.TokenHash = evv.hmac.Hash(ev.Token)
+	return nil
+}
+
+func (evv *emailVerificationValidation) setExpiry(ev *EmailVerification) error {
+	if ev.ExpiresAt.IsZero() {
+		ev.ExpiresAt = time.Now().Add(EmailVerificationExpiry)
+	}
+	return nil
+}
+
+func (evv *emailVerificationValidation) Create(ev *EmailVerification) error {
+	if err := runEmailVerificationValFns(ev,
+		evv.checkForUserID,
+		evv.generateToken,
+		evv.tokenHash,
+		evv.setExpiry,
+	); err != nil {
+		return err
+	}
+	return evv.EmailVerificationDB.Create(ev)
+}
+
+func (evv *emailVerificationValidation) ByToken(token string) (*EmailVerification, error) {
+	ev := &EmailVerification{
+		Token: token,
+	}
+	if err := runEmailVerificationValFns(ev, evv.tokenHash); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, tokenHash := range evv.hmac.Hashes(ev.Token) {
+		var found *EmailVerification
+		if found, err = evv.EmailVerificationDB.ByToken(tokenHash); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (evv *emailVerificationValidation) DeleteByUser(userID uint) error {
+	if userID == 0 {
+		return ErrUserIDMissing
+	}
+	return evv.EmailVerificationDB.DeleteByUser(userID)
+}
+
+// ##################### Email Verification Gorm ################################ //
+
+func (evg *emailVerificationGorm) Create(ev *EmailVerification) error {
+	return evg.db.Create(ev).Error
+}
+
+// ByToken expects the already hashed token
+func (evg *emailVerificationGorm) ByToken(tokenHash string) (*EmailVerification, error) {
+	var ev EmailVerification
+	if err := evg.db.Where("token_hash = ?", tokenHash).First(&ev).Error; err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func (evg *emailVerificationGorm) DeleteByUser(userID uint) error {
+	return evg.db.Unscoped().Where("user_id = ?", userID).Delete(EmailVerification{}).Error
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"crypto/subtle"
+
+	"github.com/jinzhu/gorm"
+
+	"profile.com/rand"
+)
+
+// Visibility decides who may see a profile field or section
+type Visibility string
+
+const (
+	// VisibilityPublic is shown to everyone
+	VisibilityPublic Visibility = "public"
+	// VisibilityUsers is shown to signed in users
+	VisibilityUsers Visibility = "users"
+	// VisibilityLink is shown to anyone holding the profile share link
+	VisibilityLink Visibility = "link"
+	// VisibilityPrivate is only shown to the owner
+	VisibilityPrivate Visibility = "private"
+
+	// shareTokenBytes is the size of the profile share token
+	shareTokenBytes = 16
+)
+
+// Visibilities lists every visibility a field can be given
+var Visibilities = []Visibility{
+	VisibilityPublic,
+	VisibilityUsers,
+	VisibilityLink,
+	VisibilityPrivate,
+}
+
+// Valid reports whether v is a known visibility
+func (v Visibility) Valid() bool {
+	for _, known := range Visibilities {
+		if v == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ProfileVisibility defines the shape of the profile visibility db. The
+// share token is kept in plain text so the owner can copy the link again,
+// it only ever grants read access to link visible fields
+type ProfileVisibility struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;unique_index"`
+	Email      Visibility `gorm:"not null"`
+	Title      Visibility `gorm:"not null"`
+	Summary    Visibility `gorm:"not null"`
+	Skills     Visibility `gorm:"not null"`
+	Experience Visibility `gorm:"not null"`
+	Education  Visibility `gorm:"not null"`
+	Projects   Visibility `gorm:"not null"`
+	ShareToken string
+}
+
+// DefaultProfileVisibility returns the settings of a user who has not
+// changed any, everything but the email address is public
+func DefaultProfileVisibility(userID uint) *ProfileVisibility {
+	return &ProfileVisibility{
+		UserID:     userID,
+		Email:      VisibilityPrivate,
+		Title:      VisibilityPublic,
+		Summary:    VisibilityPublic,
+		Skills:     VisibilityPublic,
+		Experience: VisibilityPublic,
+		Education:  VisibilityPublic,
+		Projects:   VisibilityPublic,
+	}
+}
+
+// Viewer describes who is looking at a profile
+type Viewer struct {
+	User       *User
+	ShareToken string
+}
+
+// CanSee reports whether viewer may see a field of the owner's profile
+// with visibility v
+func (pv *ProfileVisibility) CanSee(v Visibility, viewer Viewer) bool {
+	if viewer.User != nil && viewer.User.ID == pv.UserID {
+		return true
+	}
+	switch v {
+	case VisibilityPublic:
+		return true
+	case VisibilityUsers:
+		return viewer.User != nil
+	case VisibilityLink:
+		return pv.ShareToken != "" &&
+			subtle.ConstantTimeCompare([]byte(viewer.ShareToken), []byte(pv.ShareToken)) == 1
+	}
+	return false
+}
+
+// VisibilityDB defines the shape of the visibility db interface
+type VisibilityDB interface {
+	ByUser(userID uint) (*ProfileVisibility, error)
+	Update(visibility *ProfileVisibility) error
+}
+
+// VisibilityService defines the shape of the visibility service
+type VisibilityService interface {
+	RegenerateShareToken(userID uint) (*ProfileVisibility, error)
+	VisibilityDB
+}
+
+type visibilityService struct {
+	VisibilityDB
+}
+type visibilityValidation struct {
+	VisibilityDB
+}
+type visibilityGorm struct {
+	db *gorm.DB
+}
+
+// NewVisibilityService returns the visibility service struct
+func NewVisibilityService(db *gorm.DB) VisibilityService {
+	vg := newVisibilityGorm(db)
+	vv := newVisibilityValidation(vg)
+	return &visibilityService{
+		VisibilityDB: vv,
+	}
+}
+
+func newVisibilityValidation(vg *visibilityGorm) *visibilityValidation {
+	return &visibilityValidation{
+		VisibilityDB: vg,
+	}
+}
+
+func newVisibilityGorm(db *gorm.DB) *visibilityGorm {
+	return &visibilityGorm{
+		db: db,
+	}
+}
+
+// ##################### Visibility Service ################################ //
+
+// RegenerateShareToken replaces the share token of the user, breaking any
+// link that was handed out before
+func (vs *visibilityService) RegenerateShareToken(userID uint) (*ProfileVisibility, error) {
+	visibility, err := vs.VisibilityDB.ByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := rand.String(shareTokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	visibility.ShareToken = token
+	if err := vs.VisibilityDB.Update(visibility); err != nil {
+		return nil, err
+	}
+	return visibility, nil
+}
+
+// ##################### Visibility Validation ################################ //
+
+type visibilityValFn func(visibility *ProfileVisibility) error
+
+func runVisibilityValFns(visibility *ProfileVisibility, fns ...visibilityValFn) error {
+	for _, fn := range fns {
+		if err := fn(visibility); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vv *visibilityValidation) checkForUserID(visibility *ProfileVisibility) error {
+	if visibility.UserID == 0 {
+		return ErrUserIDMissing
+	}
+	return nil
+}
+
+func (vv *visibilityValidation) checkVisibilities(visibility *ProfileVisibility) error {
+	for _, v := range []Visibility{
+		visibility.Email,
+		visibility.Title,
+		visibility.Summary,
+		visibility.Skills,
+		visibility.Experience,
+		visibility.Education,
+		visibility.Projects,
+	} {
+		if !v.Valid() {
+			return ErrVisibilityInvalid
+		}
+	}
+	return nil
+}
+
+func (vv *visibilityValidation) ByUser(userID uint) (*ProfileVisibility, error) {
+	if userID == 0 {
+		return nil, ErrUserIDMissing
+	}
+	return vv.VisibilityDB.ByUser(userID)
+}
+
+func (vv *visibilityValidation) Update(visibility *ProfileVisibility) error {
+	if err := runVisibilityValFns(visibility,
+		vv.checkForUserID,
+		vv.checkVisibilities,
+	); err != nil {
+		return err
+	}
+	return vv.VisibilityDB.Update(visibility)
+}
+
+// ##################### Visibility Gorm ################################ //
+
+// ByUser returns the settings of the user, falling back to the defaults
+// for users who never saved any
+func (vg *visibilityGorm) ByUser(userID uint) (*ProfileVisibility, error) {
+	var visibility ProfileVisibility
+	err := vg.db.Where("user_id = ?", userID).First(&visibility).Error
+	switch err {
+	case nil:
+		return &visibility, nil
+	case gorm.ErrRecordNotFound:
+		return DefaultProfileVisibility(userID), nil
+	}
+	return nil, err
+}
+
+func (vg *visibilityGorm) Update(visibility *ProfileVisibility) error {
+	return vg.db.Save(visibility).Error
+}
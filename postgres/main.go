@@ -1,26 +1,37 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/lib/pq"
-)
 
-const (
-	host   = "localhost"
-	port   = 5432
-	user   = "postgres"
-	dbname = "profile_dev"
+	"profile.com/config"
+	"profile.com/migrate"
 )
 
 func main() {
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		" dbname=%s sslmode=disable",
-		host, port, user, dbname)
-	_, err := gorm.Open("postgres", psqlInfo)
+	cfg, _, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	db, err := gorm.Open("postgres", cfg.Database.ConnectionInfo())
 	if err != nil {
 		panic(err)
 	}
+	defer db.Close()
+	m, err := migrate.New(db.DB())
+	if err != nil {
+		panic(err)
+	}
+	if _, err := m.Up(); err != nil {
+		panic(err)
+	}
 	fmt.Println("Postgres Database has been setup successfully")
 }
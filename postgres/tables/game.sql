@@ -1,16 +0,0 @@
-BEGIN TRANSACTION;
-
-CREATE TABLE users (
-id SERIAL PRIMARY KEY,
-name TEXT,
-email TEXT NOT NULL
-);
-
-CREATE TABLE orders (
-id SERIAL PRIMARY KEY,
-user_id INT NOT NULL,
-amount INT,
-description TEXT
-);
-
-COMMIT;
\ No newline at end of file
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no blob is stored under a key
+	ErrNotFound = errors.New("storage: blob not found")
+	// ErrKeyInvalid is returned for keys that are empty or try to leave
+	// the store
+	ErrKeyInvalid = errors.New("storage: key is invalid")
+)
+
+// Info describes a stored blob
+type Info struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Blob stores opaque files under slash separated keys such as
+// "avatars/12/3fa9c1-128.jpg"
+type Blob interface {
+	// Put stores the content of r under key, replacing what was there
+	Put(key string, r io.Reader, contentType string) error
+	// Get opens the blob stored under key, the caller closes it
+	Get(key string) (io.ReadCloser, *Info, error)
+	// Delete removes the blob stored under key, missing blobs are not an
+	// error
+	Delete(key string) error
+}
+
+// cleanKey checks key stays inside the store and normalizes it
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, `\`) || strings.HasPrefix(key, "/") {
+		return "", ErrKeyInvalid
+	}
+	clean := path.Clean(key)
+	if clean != key || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ErrKeyInvalid
+	}
+	return clean, nil
+}
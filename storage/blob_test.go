@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// testBlob runs the Blob contract against the store newBlob returns, every
+// implementation has to pass it
+func testBlob(t *testing.T, newBlob func(t *testing.T) Blob) {
+	put := func(t *testing.T, b Blob, key, content, contentType string) {
+		t.Helper()
+		if err := b.Put(key, strings.NewReader(content), contentType); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	get := func(t *testing.T, b Blob, key string) (string, *Info) {
+		t.Helper()
+		r, info, err := b.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading %q: %v", key, err)
+		}
+		return string(content), info
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		b := newBlob(t)
+		put(t, b, "avatars/12/3fa9c1-128.png", "png bytes", "image/png")
+		content, info := get(t, b, "avatars/12/3fa9c1-128.png")
+		if content != "png bytes" {
+			t.Errorf("content = %q, want %q", content, "png bytes")
+		}
+		if info.ContentType != "image/png" {
+			t.Errorf("ContentType = %q, want %q", info.ContentType, "image/png")
+		}
+		if info.Size != int64(len("png bytes")) {
+			t.Errorf("Size = %d, want %d", info.Size, len("png bytes"))
+		}
+		if info.ModTime.IsZero() {
+			t.Error("ModTime is zero")
+		}
+	})
+
+	t.Run("put replaces", func(t *testing.T) {
+		b := newBlob(t)
+		put(t, b, "avatars/1/a.jpg", "old", "image/jpeg")
+		put(t, b, "avatars/1/a.jpg", "newer", "image/jpeg")
+		if content, _ := get(t, b, "avatars/1/a.jpg"); content != "newer" {
+			t.Errorf("content = %q, want %q", content, "newer")
+		}
+	})
+
+	t.Run("get missing", func(t *testing.T) {
+		b := newBlob(t)
+		if _, _, err := b.Get("avatars/1/missing.png"); err != ErrNotFound {
+			t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		b := newBlob(t)
+		put(t, b, "avatars/1/a.png", "png", "image/png")
+		put(t, b, "avatars/1/b.png", "png", "image/png")
+		if err := b.Delete("avatars/1/a.png"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, _, err := b.Get("avatars/1/a.png"); err != ErrNotFound {
+			t.Errorf("Get() after Delete error = %v, want %v", err, ErrNotFound)
+		}
+		if content, _ := get(t, b, "avatars/1/b.png"); content != "png" {
+			t.Errorf("other blob content = %q, want %q", content, "png")
+		}
+		if err := b.Delete("avatars/1/a.png"); err != nil {
+			t.Errorf("Delete() of missing blob error = %v, want nil", err)
+		}
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		b := newBlob(t)
+		for _, key := range []string{"", "/avatars/1.png", "../1.png", "avatars/../../1.png", "avatars//1.png", `avatars\1.png`, ".", ".."} {
+			if err := b.Put(key, strings.NewReader("x"), "image/png"); err != ErrKeyInvalid {
+				t.Errorf("Put(%q) error = %v, want %v", key, err, ErrKeyInvalid)
+			}
+			if _, _, err := b.Get(key); err != ErrKeyInvalid {
+				t.Errorf("Get(%q) error = %v, want %v", key, err, ErrKeyInvalid)
+			}
+			if err := b.Delete(key); err != ErrKeyInvalid {
+				t.Errorf("Delete(%q) error = %v, want %v", key, err, ErrKeyInvalid)
+			}
+		}
+	})
+}
+
+func TestDisk(t *testing.T) {
+	testBlob(t, func(t *testing.T) Blob {
+		d, err := NewDisk(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	})
+}
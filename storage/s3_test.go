@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3(t *testing.T) {
+	testBlob(t, func(t *testing.T) Blob {
+		srv := httptest.NewServer(newFakeS3())
+		t.Cleanup(srv.Close)
+		s3, err := NewS3(S3Options{
+			Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+			AccessKey: "access",
+			SecretKey: "secret",
+			Bucket:    "uploads",
+			Region:    "us-east-1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s3
+	})
+}
+
+func TestNewS3CreatesBucket(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	_, err := NewS3(S3Options{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		AccessKey: "access",
+		SecretKey: "secret",
+		Bucket:    "uploads",
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("NewS3() error = %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if _, ok := fake.buckets["uploads"]; !ok {
+		t.Error("bucket was not created")
+	}
+}
+
+// fakeS3 is an in memory S3 server, just enough of the API for the S3
+// store: path style buckets and single part objects. Signatures are not
+// checked
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		buckets: map[string]map[string]fakeObject{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	objects, exists := f.buckets[bucket]
+	if len(parts) == 1 || parts[1] == "" {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Has("location"):
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		case r.Method == http.MethodHead && exists:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			if !exists {
+				f.buckets[bucket] = map[string]fakeObject{}
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", bucket, "")
+		}
+		return
+	}
+	key := parts[1]
+	if !exists {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchBucket", bucket, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := readFakeS3Body(r)
+		if err != nil {
+			fakeS3Error(w, http.StatusBadRequest, "IncompleteBody", bucket, key)
+			return
+		}
+		obj := fakeObject{
+			data:        data,
+			contentType: r.Header.Get("Content-Type"),
+			modTime:     time.Now().UTC().Truncate(time.Second),
+		}
+		objects[key] = obj
+		w.Header().Set("ETag", obj.etag())
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey", bucket, key)
+			return
+		}
+		h := w.Header()
+		h.Set("Content-Type", obj.contentType)
+		h.Set("Content-Length", strconv.Itoa(len(obj.data)))
+		h.Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		h.Set("ETag", obj.etag())
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", bucket, key)
+	}
+}
+
+func (o fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code, bucket, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message><BucketName>%s</BucketName><Key>%s</Key></Error>`,
+		code, code, bucket, key)
+}
+
+// readFakeS3Body reads an upload, decoding the aws-chunked encoding the
+// client uses to sign the body as it streams
+func readFakeS3Body(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Decoded-Content-Length") == "" {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 const (
 	// ErrLevelDanger is error color for bootstrap alert
 	ErrLevelDanger = "danger"
+	// LevelSuccess is success color for bootstrap alert
+	LevelSuccess = "success"
 )
 
 // Alert defines the shape of the alert object
@@ -17,9 +19,10 @@ type Alert struct {
 
 // Data defines the shape of the page data
 type Data struct {
-	Alert *Alert
-	User  *models.User
-	Yield interface{}
+	Alert     *Alert
+	User      *models.User
+	CSRFToken string
+	Yield     interface{}
 }
 
 // SetAlert sets the Alert object on a data struct
@@ -29,3 +32,11 @@ func (d *Data) SetAlert(level string, err error) {
 		Message: err.Error(),
 	}
 }
+
+// SetAlertMessage sets an Alert with a plain message on a data struct
+func (d *Data) SetAlertMessage(level, message string) {
+	d.Alert = &Alert{
+		Level:   level,
+		Message: message,
+	}
+}
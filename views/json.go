@@ -0,0 +1,55 @@
+package views
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const contentTypeJSON = "application/json"
+
+// JSONError defines the shape of the error body of a JSON response
+type JSONError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// WantsJSON reports whether the client asked for JSON ahead of HTML in
+// its Accept header
+func WantsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentTypeJSON:
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
+
+// RenderJSON writes v as the JSON body of the response
+func RenderJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentTypeJSON+"; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+// RenderJSONError writes a JSON error body with the given status
+func RenderJSONError(w http.ResponseWriter, status int, message string) {
+	RenderJSON(w, status, struct {
+		Error JSONError `json:"error"`
+	}{
+		Error: JSONError{
+			Status:  status,
+			Message: message,
+		},
+	})
+}
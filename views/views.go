@@ -1,9 +1,9 @@
 package views
 
 import (
+	"html/template"
 	"net/http"
 	"path/filepath"
-	"text/template"
 
 	"profile.com/context"
 )
@@ -11,6 +11,9 @@ import (
 const (
 	fileExt    = ".html"
 	filePrefix = "views/"
+
+	// CSRFField is the name of the form field holding the CSRF token
+	CSRFField = "csrf_token"
 )
 
 // Views defines the shape of the views
@@ -39,7 +42,7 @@ func NewView(layout, file string) *Views {
 	handleExts(files)
 	lf := layoutFiles()
 	files = append(files, lf...)
-	t, err := template.ParseFiles(files...)
+	t, err := template.New(filepath.Base(files[0])).Funcs(csrfFuncs("")).ParseFiles(files...)
 	if err != nil {
 		panic(err)
 	}
@@ -62,7 +65,29 @@ func (v *Views) Render(w http.ResponseWriter, r *http.Request, data interface{})
 
 	user := context.GetUserFromContext(r.Context())
 	vd.User = user
-	if err := v.t.ExecuteTemplate(w, v.layout, vd); err != nil {
+	vd.CSRFToken = context.GetCSRFTokenFromContext(r.Context())
+	t, err := v.t.Clone()
+	if err != nil {
+		panic(err)
+	}
+	t.Funcs(csrfFuncs(vd.CSRFToken))
+	if err := t.ExecuteTemplate(w, v.layout, vd); err != nil {
 		panic(err)
 	}
 }
+
+// csrfFuncs lets every form, however deep in a template, write the token
+// of the current request with {{ csrfField }}. Scripts read it from
+// {{ csrfToken }}
+func csrfFuncs(token string) template.FuncMap {
+	field := template.HTML(`<input type="hidden" name="` + CSRFField + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+	return template.FuncMap{
+		"csrfToken": func() string {
+			return token
+		},
+		"csrfField": func() template.HTML {
+			return field
+		},
+	}
+}